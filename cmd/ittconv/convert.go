@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mediafellows/ittconv"
+
+	"github.com/alecthomas/kong"
+)
+
+// ConvertCmd converts an .itt file to WebVTT or TTML.
+type ConvertCmd struct {
+	InputFile        string        `kong:"arg,required,help='Input .itt file path.',type='existingfile'"`
+	OutputFile       string        `kong:"short='o',help='Output file path. If not provided, output is written to stdout.'"`
+	Format           string        `kong:"short='f',help='Output format (vtt or ttml). Defaults to vtt.',default='vtt'"`
+	Lenient          bool          `kong:"help='Repair or drop invalid cues instead of failing.'"`
+	AllErrors        bool          `kong:"help='Report every problem in the input instead of stopping at the first one.'"`
+	Repair           string        `kong:"help='How lenient mode repairs inverted cues (drop, swap or extend).',enum='drop,swap,extend',default='drop'"`
+	MinDuration      time.Duration `kong:"help='Cue duration used by --repair=extend.',default='1s'"`
+	UnknownRefs      string        `kong:"help='How to handle references to undefined styles and regions (keep, drop, default or fail).',enum='keep,drop,default,fail',default='keep'"`
+	DefaultStyle     string        `kong:"help='Style that replaces unknown style references with --unknown-refs=default.'"`
+	DefaultRegion    string        `kong:"help='Region that replaces unknown region references with --unknown-refs=default.'"`
+	Normalize        []string      `kong:"help='Text clean-ups to apply (indent, spaces, breaks, curly-quotes, straight-quotes, ellipsis, dashes).',enum='indent,spaces,breaks,curly-quotes,straight-quotes,ellipsis,dashes',sep=','"`
+	StripSDH         bool          `kong:"name='strip-sdh',help='Remove sound descriptions, music notes and speaker labels to derive plain subtitles from SDH subtitles.'"`
+	MergeStripped    bool          `kong:"help='Merge neighbouring cues that --strip-sdh leaves with the same text.'"`
+	MergeStrippedGap time.Duration `kong:"help='Largest gap between two cues merged by --merge-stripped.',default='0s'"`
+	Overlaps         string        `kong:"help='How to resolve cues that overlap in time (keep, trim, merge or stack).',enum='keep,trim,merge,stack',default='keep'"`
+	MinGap           int           `kong:"help='Minimum gap between consecutive cues, in frames.'"`
+	ChainGap         int           `kong:"help='Close gaps shorter than this many frames down to --min-gap.'"`
+	SplitDuration    time.Duration `kong:"help='Split cues that last longer than this at line breaks and sentence ends.'"`
+	SplitChars       int           `kong:"help='Split cues with more characters than this at line breaks and sentence ends.'"`
+	MergeDuration    time.Duration `kong:"help='Merge cues shorter than this with the following cue.'"`
+	MergeGap         time.Duration `kong:"help='Largest gap between two cues merged by --merge-duration.',default='0s'"`
+	WrapChars        int           `kong:"help='Rewrap cues with lines longer than this many characters.'"`
+	WrapLines        int           `kong:"help='Number of lines --wrap-chars aims for; longer cues are reported.',default='2'"`
+	RootExtent       string        `kong:"help='Video size in pixels, such as 1920px 1080px, used to convert lengths given in pixels. Overrides the tts:extent of the input.'"`
+	Layout           string        `kong:"help='How WebVTT output places cues (settings or regions).',enum='settings,regions',default='settings'"`
+	Lang             string        `kong:"help='BCP 47 language tag of the subtitles, such as en-US. Overrides the xml:lang of the input.'"`
+	Title            string        `kong:"help='Title written to the TTML metadata. Overrides the ttm:title of the input.'"`
+	Description      string        `kong:"help='Description written to the TTML metadata. Overrides the ttm:desc of the input.'"`
+	Copyright        string        `kong:"help='Copyright notice written to the TTML metadata. Overrides the ttm:copyright of the input.'"`
+}
+
+func (c *ConvertCmd) Run(ctx *kong.Context) error {
+	// Read input file
+	inputData, err := ioutil.ReadFile(c.InputFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read input file: %v", err)
+	}
+
+	repair, err := ittconv.ParseRepairStrategy(c.Repair)
+	if err != nil {
+		return err
+	}
+	references, err := ittconv.ParseReferencePolicy(c.UnknownRefs)
+	if err != nil {
+		return err
+	}
+	overlaps, err := ittconv.ParseOverlapStrategy(c.Overlaps)
+	if err != nil {
+		return err
+	}
+	normalize, err := ittconv.ParseNormalizeRules(c.Normalize)
+	if err != nil {
+		return err
+	}
+	layout, err := ittconv.ParseLayout(c.Layout)
+	if err != nil {
+		return err
+	}
+	opts := ittconv.Options{
+		Lenient:          c.Lenient,
+		CollectErrors:    c.AllErrors,
+		Repair:           repair,
+		MinDuration:      c.MinDuration,
+		References:       references,
+		DefaultStyle:     c.DefaultStyle,
+		DefaultRegion:    c.DefaultRegion,
+		Normalize:        normalize,
+		StripSDH:         c.StripSDH,
+		MergeStripped:    c.MergeStripped,
+		MergeStrippedGap: c.MergeStrippedGap,
+		Overlaps:         overlaps,
+		MinGapFrames:     c.MinGap,
+		ChainFrames:      c.ChainGap,
+		SplitDuration:    c.SplitDuration,
+		SplitChars:       c.SplitChars,
+		MergeDuration:    c.MergeDuration,
+		MergeGap:         c.MergeGap,
+		WrapChars:        c.WrapChars,
+		WrapLines:        c.WrapLines,
+		RootExtent:       c.RootExtent,
+		Layout:           layout,
+		Language:         c.Lang,
+		Title:            c.Title,
+		Description:      c.Description,
+		Copyright:        c.Copyright,
+		OnDiagnostic: func(d ittconv.Diagnostic) {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", filepath.Base(c.InputFile), d)
+		},
+	}
+
+	// Convert to the target format
+	var output string
+	switch c.Format {
+	case "vtt":
+		output, err = ittconv.ToVTTWithOptions(string(inputData), opts)
+	case "ttml":
+		output, err = ittconv.ToTTMLWithOptions(string(inputData), opts)
+	default:
+		return fmt.Errorf("Unsupported format: %s. Please use 'vtt' or 'ttml'.", c.Format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to convert to %s: %v", c.Format, err)
+	}
+
+	// Write output
+	if c.OutputFile != "" {
+		err = ioutil.WriteFile(c.OutputFile, []byte(output), 0644)
+		if err != nil {
+			return fmt.Errorf("Failed to write to output file: %v", err)
+		}
+		fmt.Fprintf(ctx.Stdout, "Successfully converted %s to %s (%s).\n", filepath.Base(c.InputFile), filepath.Base(c.OutputFile), c.Format)
+	} else {
+		fmt.Fprint(ctx.Stdout, output)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/mediafellows/ittconv/internal/checker"
+
+	"github.com/alecthomas/kong"
+)
+
+// LintCmd checks .itt files against the iTunes Timed Text constraints.
+type LintCmd struct {
+	Files      []string `kong:"arg,required,help='Input .itt files to check.',type='existingfile'"`
+	MaxLines   int      `kong:"help='Maximum number of lines per cue.',default='2'"`
+	MaxRegions int      `kong:"help='Maximum number of region definitions.',default='4'"`
+}
+
+func (c *LintCmd) Run(ctx *kong.Context) error {
+	rules := checker.ITunes()
+	rules.MaxLines = c.MaxLines
+	rules.MaxRegions = c.MaxRegions
+
+	problems := 0
+	for _, path := range c.Files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read input file: %v", err)
+		}
+		findings := checker.Check(string(data), rules)
+		for _, f := range findings {
+			fmt.Fprintf(ctx.Stdout, "%s:%s\n", path, f)
+		}
+		problems += len(findings)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/qc"
+
+	"github.com/alecthomas/kong"
+)
+
+// QCCmd checks the timing and layout of .itt files against a client profile.
+type QCCmd struct {
+	Files           []string      `kong:"arg,required,help='Input .itt files to check.',type='existingfile'"`
+	Profile         string        `kong:"short='p',help='Client profile (netflix or bbc).',enum='netflix,bbc',default='netflix'"`
+	Format          string        `kong:"short='f',help='Report format (text or json).',enum='text,json',default='text'"`
+	MaxCPS          float64       `kong:"name='max-cps',help='Override the maximum characters per second.'"`
+	MaxCharsPerLine int           `kong:"help='Override the maximum characters per line.'"`
+	MaxLines        int           `kong:"help='Override the maximum lines per cue.'"`
+	MinDuration     time.Duration `kong:"help='Override the minimum cue duration.'"`
+	MinGap          int           `kong:"help='Override the minimum gap between cues, in frames.'"`
+}
+
+func (c *QCCmd) Run(ctx *kong.Context) error {
+	profile, err := qc.LookupProfile(c.Profile)
+	if err != nil {
+		return err
+	}
+	if c.MaxCPS > 0 {
+		profile.MaxCPS = c.MaxCPS
+	}
+	if c.MaxCharsPerLine > 0 {
+		profile.MaxCharsPerLine = c.MaxCharsPerLine
+	}
+	if c.MaxLines > 0 {
+		profile.MaxLines = c.MaxLines
+	}
+	if c.MinDuration > 0 {
+		profile.MinDuration = c.MinDuration
+	}
+	if c.MinGap > 0 {
+		profile.MinGapFrames = c.MinGap
+	}
+
+	var reports []qc.Report
+	problems := 0
+	for _, path := range c.Files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read input file: %v", err)
+		}
+		doc, err := parser.ParseITT(string(data))
+		if err != nil {
+			return fmt.Errorf("Failed to parse %s: %v", path, err)
+		}
+		report := qc.Check(doc, profile)
+		report.File = path
+		problems += len(report.Issues)
+		if c.Format == "json" {
+			reports = append(reports, report)
+			continue
+		}
+		if err := report.WriteText(ctx.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if c.Format == "json" {
+		if err := qc.WriteJSON(ctx.Stdout, reports); err != nil {
+			return err
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
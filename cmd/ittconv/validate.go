@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/ttml"
+	"github.com/mediafellows/ittconv/internal/vtt"
+
+	"github.com/alecthomas/kong"
+)
+
+// ValidateCmd checks TTML files against the schema rules in internal/ttml,
+// or WebVTT files against the syntax rules in internal/vtt.
+type ValidateCmd struct {
+	Files  []string `kong:"arg,required,help='Files to validate.',type='existingfile'"`
+	Format string   `kong:"short='f',default='ttml',enum='ttml,vtt',help='Format of the input files (ttml or vtt).'"`
+}
+
+func (c *ValidateCmd) Run(ctx *kong.Context) error {
+	problems := 0
+	for _, path := range c.Files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read input file: %v", err)
+		}
+		var findings []errs.Finding
+		switch c.Format {
+		case "vtt":
+			findings = vtt.Validate(string(data))
+		default:
+			findings = ttml.Validate(string(data))
+		}
+		for _, f := range findings {
+			fmt.Fprintf(ctx.Stdout, "%s:%s\n", path, f)
+		}
+		problems += len(findings)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
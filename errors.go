@@ -0,0 +1,26 @@
+package ittconv
+
+import (
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// Error categories returned by the conversion functions. Test for them with
+// errors.Is. All of them except ErrIO describe problems with the content being
+// converted, so retrying the same input will fail the same way.
+var (
+	ErrMissingFrameRate  = errs.ErrMissingFrameRate
+	ErrInvalidFrameRate  = errs.ErrInvalidFrameRate
+	ErrInvalidTimecode   = errs.ErrInvalidTimecode
+	ErrCueTimingInverted = errs.ErrCueTimingInverted
+	ErrUnknownReference  = errs.ErrUnknownReference
+	ErrInvalidLength     = errs.ErrInvalidLength
+	ErrInvalidLanguage   = errs.ErrInvalidLanguage
+	ErrMalformedXML      = errs.ErrMalformedXML
+	ErrValidation        = errs.ErrValidation
+	ErrIO                = errs.ErrIO
+)
+
+// ParseError describes a located problem in the ITT source. Retrieve it with
+// errors.As to obtain the line, column, element and attribute involved.
+type ParseError = parser.ParseError
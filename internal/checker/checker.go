@@ -0,0 +1,315 @@
+// Package checker validates .itt input against the constraints of the iTunes
+// Timed Text specification, so that deliveries Apple would reject can be
+// caught before upload.
+package checker
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/units"
+)
+
+const (
+	namespaceParameter = "http://www.w3.org/ns/ttml#parameter"
+	namespaceStyling   = "http://www.w3.org/ns/ttml#styling"
+	namespaceXML       = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Rules holds the constraints Check enforces.
+type Rules struct {
+	// FrameRates lists the allowed effective frame rates as rationals, e.g.
+	// "24000/1001" for frameRate="24" with frameRateMultiplier="1000 1001" or
+	// "2997/125" for the same rate written with frameRateMultiplier="999 1000".
+	FrameRates []string
+	// MaxRegions is the maximum number of region definitions.
+	MaxRegions int
+	// MaxLines is the maximum number of lines per cue.
+	MaxLines int
+	// StyleValues maps each allowed styling attribute to its allowed values.
+	// A nil slice allows any value.
+	StyleValues map[string][]string
+}
+
+// ITunes returns the constraints of the iTunes Timed Text specification.
+func ITunes() Rules {
+	return Rules{
+		FrameRates: []string{
+			"24000/1001", "2997/125", "24", "25",
+			"30000/1001", "2997/100", "30", "50",
+			"60000/1001", "2997/50", "60",
+		},
+		MaxRegions: 4,
+		MaxLines:   2,
+		StyleValues: map[string][]string{
+			"color":           nil,
+			"backgroundColor": nil,
+			"fontFamily":      nil,
+			"fontSize":        nil,
+			"fontStyle":       {"normal", "italic"},
+			"fontWeight":      {"normal", "bold"},
+			"textDecoration":  {"none", "underline"},
+			"textAlign":       {"left", "center", "right", "start", "end"},
+			"displayAlign":    {"before", "center", "after"},
+			"origin":          nil,
+			"extent":          nil,
+			"writingMode":     {"lrtb", "rltb", "tbrl", "tblr", "lr", "rl", "tb"},
+			"ruby":            nil,
+			"textCombine":     nil,
+			"direction":       {"ltr", "rtl"},
+			"unicodeBidi":     {"normal", "embed", "bidiOverride"},
+		},
+	}
+}
+
+// parameterAttrs lists the <tt> attributes iTT requires in the ttp namespace.
+var parameterAttrs = []string{"timeBase", "frameRate", "frameRateMultiplier", "dropMode"}
+
+// Check validates ittSource against rules and returns the findings in
+// document order. Timing problems detected by the parser, such as invalid
+// timecodes and inverted cues, are reported as well.
+func Check(ittSource string, rules Rules) []errs.Finding {
+	c := &checker{rules: rules}
+	c.scan([]byte(ittSource))
+	c.parse(ittSource)
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		a, b := c.findings[i], c.findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.findings
+}
+
+type checker struct {
+	rules    Rules
+	findings []errs.Finding
+	regions  int
+}
+
+func (c *checker) report(at errs.Finding, attr, format string, args ...any) {
+	at.Attr = attr
+	at.Message = fmt.Sprintf(format, args...)
+	c.findings = append(c.findings, at)
+}
+
+// scan walks the XML and applies the structural rules.
+func (c *checker) scan(data []byte) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	columns := errs.NewColumns(data)
+	var cue *errs.Finding // the <p> being read
+	lines := 0
+	depth := 0
+
+	for {
+		line, _ := dec.InputPos()
+		col := columns.At(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, _ = dec.InputPos()
+			col = columns.At(dec.InputOffset())
+			c.findings = append(c.findings, errs.Finding{Line: line, Column: col, Message: fmt.Sprintf("malformed XML: %v", err)})
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			at := errs.Finding{Line: line, Column: col, Element: t.Name.Local}
+			switch t.Name.Local {
+			case "tt":
+				if depth == 1 {
+					c.checkRoot(at, t.Attr)
+				}
+			case "region":
+				c.regions++
+				if c.regions == c.rules.MaxRegions+1 {
+					c.report(at, "", "more than %d regions defined", c.rules.MaxRegions)
+				}
+				c.checkID(at, t.Attr)
+				c.checkRegion(at, t.Attr)
+				c.checkStyles(at, t.Attr)
+			case "style":
+				c.checkID(at, t.Attr)
+				c.checkStyles(at, t.Attr)
+			case "p":
+				cue = &at
+				lines = 1
+				c.checkStyles(at, t.Attr)
+			case "span":
+				c.checkStyles(at, t.Attr)
+			case "br":
+				if cue != nil {
+					lines++
+				}
+			}
+		case xml.EndElement:
+			depth--
+			if t.Name.Local == "p" && cue != nil {
+				if lines > c.rules.MaxLines {
+					c.report(*cue, "", "cue has %d lines, at most %d allowed", lines, c.rules.MaxLines)
+				}
+				cue = nil
+			}
+		}
+	}
+}
+
+// checkRoot applies the rules for the <tt> element's timing parameters.
+func (c *checker) checkRoot(at errs.Finding, attrs []xml.Attr) {
+	values := map[string]string{}
+	for _, a := range attrs {
+		if !slices.Contains(parameterAttrs, a.Name.Local) {
+			continue
+		}
+		if a.Name.Space != namespaceParameter {
+			c.report(at, a.Name.Local, "attribute must be in the ttp namespace (ttp:%s)", a.Name.Local)
+		}
+		values[a.Name.Local] = a.Value
+	}
+
+	if tb, ok := values["timeBase"]; !ok {
+		c.report(at, "ttp:timeBase", `missing required ttp:timeBase="smpte"`)
+	} else if tb != "smpte" {
+		c.report(at, "ttp:timeBase", `time base must be "smpte", got %q`, tb)
+	}
+
+	fr, ok := values["frameRate"]
+	if !ok {
+		c.report(at, "ttp:frameRate", "missing required ttp:frameRate")
+		return
+	}
+	base, err := strconv.Atoi(fr)
+	if err != nil || base <= 0 {
+		c.report(at, "ttp:frameRate", "frame rate must be a positive integer, got %q", fr)
+		return
+	}
+	rate := big.NewRat(int64(base), 1)
+	if m, ok := values["frameRateMultiplier"]; ok {
+		var num, den int
+		if parts := strings.Fields(m); len(parts) == 2 {
+			num, _ = strconv.Atoi(parts[0])
+			den, _ = strconv.Atoi(parts[1])
+		}
+		if num <= 0 || den <= 0 {
+			c.report(at, "ttp:frameRateMultiplier", "invalid frame rate multiplier %q", m)
+			return
+		}
+		rate.Mul(rate, big.NewRat(int64(num), int64(den)))
+	}
+	if !slices.Contains(c.rules.FrameRates, rate.RatString()) {
+		c.report(at, "ttp:frameRate", "frame rate %s fps is not allowed", rate.FloatString(3))
+	}
+}
+
+// checkID reports style and region definitions without an xml:id.
+func (c *checker) checkID(at errs.Finding, attrs []xml.Attr) {
+	for _, a := range attrs {
+		if a.Name.Local != "id" {
+			continue
+		}
+		if a.Name.Space != namespaceXML {
+			c.report(at, a.Name.Local, "attribute must be xml:id")
+		}
+		return
+	}
+	c.report(at, "xml:id", "missing required xml:id")
+}
+
+// checkRegion verifies that a region lies within the video frame.
+func (c *checker) checkRegion(at errs.Finding, attrs []xml.Attr) {
+	var origin, extent []float64
+	for _, a := range attrs {
+		var err error
+		switch a.Name.Local {
+		case "origin":
+			origin, err = percentages(a.Value)
+		case "extent":
+			extent, err = percentages(a.Value)
+		default:
+			continue
+		}
+		if err != nil {
+			c.report(at, "tts:"+a.Name.Local, "%v", err)
+		}
+	}
+	if origin == nil || extent == nil {
+		return
+	}
+	for i, axis := range []string{"horizontally", "vertically"} {
+		if origin[i]+extent[i] > 100 {
+			c.report(at, "tts:extent", "region extends %s outside the video frame (%g%% + %g%%)", axis, origin[i], extent[i])
+		}
+	}
+}
+
+// checkStyles verifies the styling attributes present on an element.
+func (c *checker) checkStyles(at errs.Finding, attrs []xml.Attr) {
+	for _, a := range attrs {
+		allowed, known := c.rules.StyleValues[a.Name.Local]
+		switch {
+		case a.Name.Space == namespaceStyling && !known:
+			c.report(at, "tts:"+a.Name.Local, "styling attribute is not allowed in iTT")
+		case !known:
+			continue
+		case a.Name.Space != namespaceStyling:
+			c.report(at, a.Name.Local, "attribute must be in the tts namespace (tts:%s)", a.Name.Local)
+		case allowed != nil && !slices.Contains(allowed, a.Value):
+			c.report(at, "tts:"+a.Name.Local, "value %q is not allowed, expected one of %s", a.Value, strings.Join(allowed, ", "))
+		}
+	}
+}
+
+// parse runs the parser to pick up timing problems.
+func (c *checker) parse(ittSource string) {
+	_, err := parser.ParseITTWithOptions(ittSource, parser.Options{CollectErrors: true})
+	if err == nil {
+		return
+	}
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+	for _, err := range problems {
+		var pe *parser.ParseError
+		if !errors.As(err, &pe) {
+			continue
+		}
+		// Frame rate and XML problems are already reported by scan.
+		if errors.Is(err, errs.ErrMissingFrameRate) || errors.Is(err, errs.ErrInvalidFrameRate) || errors.Is(err, errs.ErrMalformedXML) {
+			continue
+		}
+		c.findings = append(c.findings, errs.Finding{Line: pe.Line, Column: pe.Column, Element: pe.Element, Attr: pe.Attr, Message: pe.Err.Error()})
+	}
+}
+
+// percentages parses a pair of lengths such as "10% 80%", which iTT requires
+// to be percentages.
+func percentages(s string) ([]float64, error) {
+	lengths, err := units.ParseLengths(s)
+	if err != nil {
+		return nil, err
+	}
+	var values []float64
+	for _, l := range lengths {
+		if l.Unit != units.Percent {
+			return nil, fmt.Errorf("length %s must be a percentage", l)
+		}
+		values = append(values, l.Value)
+	}
+	return values, nil
+}
@@ -0,0 +1,107 @@
+package checker
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCheck_Fixtures(t *testing.T) {
+	for _, path := range []string{"../../testdata/valid_input.itt", "../../testdata/shifted.itt"} {
+		ittSource, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read test fixture: %v", err)
+		}
+		for _, f := range Check(string(ittSource), ITunes()) {
+			t.Errorf("%s: unexpected finding: %s", path, f)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	const root = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" xml:lang="en" ttp:timeBase="smpte" ttp:frameRate="24">`
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "TimeBaseAndFrameRate",
+			input: "<tt xmlns=\"http://www.w3.org/ns/ttml\" xmlns:ttp=\"http://www.w3.org/ns/ttml#parameter\"\n    ttp:timeBase=\"media\" ttp:frameRate=\"48\">\n<body/></tt>",
+			want: []string{
+				`1:1: <tt> ttp:timeBase: time base must be "smpte", got "media"`,
+				`1:1: <tt> ttp:frameRate: frame rate 48.000 fps is not allowed`,
+			},
+		},
+		{
+			name:  "UnprefixedParameters",
+			input: `<tt xmlns="http://www.w3.org/ns/ttml" timeBase="smpte" frameRate="25"><body/></tt>`,
+			want: []string{
+				`1:1: <tt> timeBase: attribute must be in the ttp namespace (ttp:timeBase)`,
+				`1:1: <tt> frameRate: attribute must be in the ttp namespace (ttp:frameRate)`,
+			},
+		},
+		{
+			name: "Regions",
+			input: root + `<head><layout>
+<region xml:id="r1" tts:origin="10% 80%" tts:extent="80% 30%"/>
+<region xml:id="r2" tts:origin="1c 80%" tts:extent="80%"/>
+<region xml:id="r3"/>
+<region xml:id="r4"/>
+<region xml:id="r5"/>
+</layout></head><body/></tt>`,
+			want: []string{
+				`2:1: <region> tts:extent: region extends vertically outside the video frame (80% + 30%)`,
+				`3:1: <region> tts:origin: length 1c must be a percentage`,
+				`3:1: <region> tts:extent: expected two lengths, got "80%"`,
+				`6:1: <region>: more than 4 regions defined`,
+			},
+		},
+		{
+			name: "Styles",
+			input: root + `<head><styling>
+<style xml:id="s1" tts:fontWeight="heavy" tts:textShadow="1px 1px"/>
+<style id="s2"/>
+</styling></head><body/></tt>`,
+			want: []string{
+				`2:1: <style> tts:fontWeight: value "heavy" is not allowed, expected one of normal, bold`,
+				`2:1: <style> tts:textShadow: styling attribute is not allowed in iTT`,
+				`3:1: <style> id: attribute must be xml:id`,
+			},
+		},
+		{
+			name: "CuesAndTiming",
+			input: root + `<body><div>
+<p begin="00:00:01:00" end="00:00:02:00">One<br/>two<br/>three</p>
+<p begin="00:00:04:00" end="00:00:03:00">Inverted</p>
+</div></body></tt>`,
+			want: []string{
+				`2:1: <p>: cue has 3 lines, at most 2 allowed`,
+				`3:1: <p>: invalid cue timing: begin time (4000/1) is not less than end time (3000/1) for cue ID 00:00:04:00`,
+			},
+		},
+		{
+			name: "NonASCII",
+			input: root + `<body><div>
+<p begin="00:00:01:00" end="00:00:02:00">Ça<br/>va<br/>bien</p><p begin="00:00:04:00" end="00:00:03:00">Où</p>
+</div></body></tt>`,
+			want: []string{
+				`2:1: <p>: cue has 3 lines, at most 2 allowed`,
+				`2:64: <p>: invalid cue timing: begin time (4000/1) is not less than end time (3000/1) for cue ID 00:00:04:00`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Check(tt.input, ITunes()) {
+				got = append(got, f.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Check findings mismatch.\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
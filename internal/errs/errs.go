@@ -0,0 +1,61 @@
+// Package errs defines the error categories shared by the conversion
+// packages. They are re-exported by the root ittconv package so callers can
+// classify failures with errors.Is. It also defines the Finding type reported
+// by the validators.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMissingFrameRate reports an ITT document without a usable frameRate.
+	ErrMissingFrameRate = errors.New("missing frame rate")
+	// ErrInvalidFrameRate reports a frameRate or frameRateMultiplier that cannot be parsed.
+	ErrInvalidFrameRate = errors.New("invalid frame rate")
+	// ErrInvalidTimecode reports a timecode that cannot be parsed or converted.
+	ErrInvalidTimecode = errors.New("invalid timecode")
+	// ErrCueTimingInverted reports a cue whose begin is not before its end.
+	ErrCueTimingInverted = errors.New("cue timing inverted")
+	// ErrUnknownReference reports a style or region reference with no definition.
+	ErrUnknownReference = errors.New("unknown reference")
+	// ErrInvalidLength reports a length, extent or cell resolution that cannot be parsed or converted.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrInvalidLanguage reports an xml:lang or language option that is not a BCP 47 language tag.
+	ErrInvalidLanguage = errors.New("invalid language")
+	// ErrMalformedXML reports input that is not well-formed XML.
+	ErrMalformedXML = errors.New("malformed XML")
+	// ErrValidation reports output, final or intermediate, that failed validation.
+	ErrValidation = errors.New("validation failed")
+	// ErrIO reports a failure to read or write data, unrelated to its content.
+	ErrIO = errors.New("I/O error")
+)
+
+// kindError tags an error with a category without altering its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Mark tags err with kind so that errors.Is(err, kind) reports true. The
+// message of err is left unchanged. A nil err is returned as is.
+func Mark(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// New formats an error like fmt.Errorf and tags it with kind.
+func New(kind error, format string, args ...any) error {
+	return Mark(kind, fmt.Errorf(format, args...))
+}
@@ -0,0 +1,66 @@
+package errs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Finding is a single problem reported by one of the validators.
+type Finding struct {
+	Line    int    // 1-based line of the problem
+	Column  int    // 1-based column in characters, or 0 if the problem covers the whole line
+	Element string // local name of the offending element, if any
+	Attr    string // qualified name of the offending attribute, if any
+	Message string
+}
+
+// String formats the finding as "line:column: <element> attr: message",
+// leaving out the parts that are not set.
+func (f Finding) String() string {
+	var sb strings.Builder
+	if f.Column > 0 {
+		fmt.Fprintf(&sb, "%d:%d: ", f.Line, f.Column)
+	} else {
+		fmt.Fprintf(&sb, "%d: ", f.Line)
+	}
+	if f.Element != "" {
+		sb.WriteString("<" + f.Element + ">")
+		if f.Attr != "" {
+			sb.WriteString(" " + f.Attr)
+		}
+		sb.WriteString(": ")
+	}
+	sb.WriteString(f.Message)
+	return sb.String()
+}
+
+// Columns converts the byte offsets reported by encoding/xml into columns
+// counted in characters, as in parser.ParseError. Offsets are expected in
+// increasing order, so that each byte is only counted once.
+type Columns struct {
+	data   []byte
+	offset int // offset of the last lookup
+	column int // column at offset
+}
+
+// NewColumns returns a Columns for data.
+func NewColumns(data []byte) *Columns {
+	return &Columns{data: data, column: 1}
+}
+
+// At returns the 1-based column of the character at offset.
+func (c *Columns) At(offset int64) int {
+	end := min(int(offset), len(c.data))
+	if end < c.offset {
+		c.offset, c.column = 0, 1
+	}
+	seg := c.data[c.offset:end]
+	if i := bytes.LastIndexByte(seg, '\n'); i >= 0 {
+		seg, c.column = seg[i+1:], 1
+	}
+	c.column += utf8.RuneCount(seg)
+	c.offset = end
+	return c.column
+}
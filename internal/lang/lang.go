@@ -0,0 +1,174 @@
+// Package lang checks and normalizes BCP 47 language tags, as used by
+// xml:lang, and tells which languages are written right to left.
+package lang
+
+import (
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+// irregular are the grandfathered tags that do not follow the tag syntax,
+// keyed by their lower-case form.
+var irregular = map[string]string{
+	"en-gb-oed":  "en-GB-oed",
+	"i-ami":      "i-ami",
+	"i-bnn":      "i-bnn",
+	"i-default":  "i-default",
+	"i-enochian": "i-enochian",
+	"i-hak":      "i-hak",
+	"i-klingon":  "i-klingon",
+	"i-lux":      "i-lux",
+	"i-mingo":    "i-mingo",
+	"i-navajo":   "i-navajo",
+	"i-pwn":      "i-pwn",
+	"i-tao":      "i-tao",
+	"i-tay":      "i-tay",
+	"i-tsu":      "i-tsu",
+	"sgn-be-fr":  "sgn-BE-FR",
+	"sgn-be-nl":  "sgn-BE-NL",
+	"sgn-ch-de":  "sgn-CH-DE",
+}
+
+// deprecated maps withdrawn ISO 639 codes to the ones that replaced them.
+var deprecated = map[string]string{
+	"in": "id",
+	"iw": "he",
+	"ji": "yi",
+}
+
+// Normalize checks that tag is a well-formed BCP 47 language tag and returns
+// it in its canonical form: subtags separated by hyphens, the language in
+// lower case, the script in title case, the region in upper case, and
+// withdrawn language codes such as "iw" replaced. Underscores are accepted
+// as separators. The empty tag, which xml:lang uses for an unknown
+// language, is returned as is.
+func Normalize(tag string) (string, error) {
+	if tag == "" {
+		return "", nil
+	}
+	lower := strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	if canonical, ok := irregular[lower]; ok {
+		return canonical, nil
+	}
+	subtags := strings.Split(lower, "-")
+	for _, s := range subtags {
+		if len(s) == 0 || len(s) > 8 || !isAlnum(s) {
+			return "", invalid(tag)
+		}
+	}
+	if subtags[0] == "x" {
+		if len(subtags) < 2 {
+			return "", invalid(tag)
+		}
+		return lower, nil
+	}
+
+	// language: 2-3 letters with up to three extlangs, or 4-8 letters.
+	first := subtags[0]
+	if len(first) < 2 || !isAlpha(first) {
+		return "", invalid(tag)
+	}
+	if r, ok := deprecated[first]; ok {
+		subtags[0] = r
+	}
+	i := 1
+	if len(first) <= 3 {
+		for n := 0; n < 3 && i < len(subtags) && len(subtags[i]) == 3 && isAlpha(subtags[i]); n++ {
+			i++
+		}
+	}
+	// script
+	if i < len(subtags) && len(subtags[i]) == 4 && isAlpha(subtags[i]) {
+		subtags[i] = strings.ToUpper(subtags[i][:1]) + subtags[i][1:]
+		i++
+	}
+	// region
+	if i < len(subtags) && (len(subtags[i]) == 2 && isAlpha(subtags[i]) || len(subtags[i]) == 3 && isDigit(subtags[i])) {
+		subtags[i] = strings.ToUpper(subtags[i])
+		i++
+	}
+	// variants
+	for i < len(subtags) && (len(subtags[i]) >= 5 || len(subtags[i]) == 4 && isDigit(subtags[i][:1])) {
+		i++
+	}
+	// extensions and private use
+	for i < len(subtags) {
+		if len(subtags[i]) != 1 {
+			return "", invalid(tag)
+		}
+		singleton := subtags[i]
+		i++
+		start := i
+		for i < len(subtags) && (singleton == "x" || len(subtags[i]) >= 2) {
+			i++
+		}
+		if i == start {
+			return "", invalid(tag)
+		}
+	}
+	return strings.Join(subtags, "-"), nil
+}
+
+// invalid returns the error for a malformed tag.
+func invalid(tag string) error {
+	return errs.New(errs.ErrInvalidLanguage, "%q is not a BCP 47 language tag", tag)
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// rtlLanguages are the languages whose default script is written right to
+// left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "arc": true, "ckb": true, "dv": true, "fa": true, "he": true,
+	"iw": true, "ji": true, "ps": true, "sd": true, "syr": true,
+	"ug": true, "ur": true, "yi": true,
+}
+
+// rtlScripts are the ISO 15924 scripts written right to left.
+var rtlScripts = map[string]bool{
+	"adlm": true, "arab": true, "hebr": true, "mand": true, "nkoo": true,
+	"rohg": true, "samr": true, "syrc": true, "thaa": true,
+}
+
+// IsRTL reports whether text in the language with the BCP 47 tag lang is
+// written right to left. A script subtag, as in "az-Arab", decides over the
+// language.
+func IsRTL(lang string) bool {
+	subtags := strings.Split(strings.ToLower(strings.ReplaceAll(lang, "_", "-")), "-")
+	for _, s := range subtags[1:] {
+		if len(s) == 1 {
+			// Extensions and private use follow a singleton.
+			break
+		}
+		if len(s) == 4 && s[0] >= 'a' && s[0] <= 'z' {
+			return rtlScripts[s]
+		}
+	}
+	return rtlLanguages[subtags[0]]
+}
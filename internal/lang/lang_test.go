@@ -0,0 +1,83 @@
+package lang
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		expectErr bool
+	}{
+		{input: "en", expected: "en"},
+		{input: "EN-us", expected: "en-US"},
+		{input: "en_GB", expected: "en-GB"},
+		{input: "zh-hant-tw", expected: "zh-Hant-TW"},
+		{input: "es-419", expected: "es-419"},
+		{input: "sr-latn-rs", expected: "sr-Latn-RS"},
+		{input: "de-CH-1996", expected: "de-CH-1996"},
+		{input: "zh-yue-HK", expected: "zh-yue-HK"},
+		{input: "en-US-u-ca-gregory", expected: "en-US-u-ca-gregory"},
+		{input: "en-x-sdh", expected: "en-x-sdh"},
+		{input: "x-whatever", expected: "x-whatever"},
+		{input: "iw", expected: "he"},
+		{input: "i-Klingon", expected: "i-klingon"},
+		{input: "", expected: ""},
+		{input: "english", expected: "english"},
+		{input: "e", expectErr: true},
+		{input: "en--US", expectErr: true},
+		{input: "en-US-", expectErr: true},
+		{input: "en-u", expectErr: true},
+		{input: "en-US-x", expectErr: true},
+		{input: "fr-FR-a-b", expectErr: true},
+		{input: "en US", expectErr: true},
+		{input: "toolonglanguage", expectErr: true},
+		{input: "12", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.input)
+		if tt.expectErr {
+			if !errors.Is(err, errs.ErrInvalidLanguage) {
+				t.Errorf("Normalize(%q): expected ErrInvalidLanguage, got %q, %v", tt.input, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Normalize(%q): unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	tests := []struct {
+		lang string
+		want bool
+	}{
+		{"ar", true},
+		{"ar-EG", true},
+		{"he", true},
+		{"fa-IR", true},
+		{"ur_PK", true},
+		{"en", false},
+		{"en-US", false},
+		{"", false},
+		{"az-Arab", true},
+		{"ku-Latn", false},
+		{"ar-Latn", false},
+		{"en-x-hebr", false},
+	}
+	for _, tt := range tests {
+		if got := IsRTL(tt.lang); got != tt.want {
+			t.Errorf("IsRTL(%q) = %v, want %v", tt.lang, got, tt.want)
+		}
+	}
+}
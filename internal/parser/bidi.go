@@ -0,0 +1,28 @@
+package parser
+
+import "github.com/mediafellows/ittconv/internal/lang"
+
+// Language returns the language of cue: its own xml:lang, or else that of
+// the document.
+func (d *ITTDocument) Language(cue Cue) string {
+	if cue.Lang != "" {
+		return cue.Lang
+	}
+	return d.Lang
+}
+
+// Direction returns the writing direction of cue, "ltr" or "rtl". It is the
+// direction set on the <p> or its styles, else that of its region, else the
+// one implied by the language of the cue.
+func (d *ITTDocument) Direction(cue Cue) string {
+	if cue.Direction != "" {
+		return cue.Direction
+	}
+	if dir := d.Regions[cue.RegionID].Direction; dir != "" {
+		return dir
+	}
+	if lang.IsRTL(d.Language(cue)) {
+		return "rtl"
+	}
+	return "ltr"
+}
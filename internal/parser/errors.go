@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a problem found while parsing an ITT document. It
+// carries the source location of the offending element so that editors and
+// tooling can jump straight to it.
+type ParseError struct {
+	Line    int    // 1-based line of the element's start tag
+	Column  int    // 1-based column (in characters) of the element's start tag
+	Element string // local name of the offending element, if known
+	Attr    string // local name of the offending attribute, if any
+	Err     error  // underlying error
+	Offset  int    // byte offset of the element's start tag, for ordering errors
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Element != "" {
+		sb.WriteString("<" + e.Element + ">")
+		if e.Attr != "" {
+			sb.WriteString(" " + e.Attr)
+		}
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Err.Error())
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError builds a ParseError located at pos.
+func newParseError(pos Position, element, attr string, err error) *ParseError {
+	return &ParseError{
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Offset:  pos.Offset,
+		Element: element,
+		Attr:    attr,
+		Err:     err,
+	}
+}
+
+// Diagnostic records a problem that the parser repaired or tolerated instead
+// of failing.
+type Diagnostic struct {
+	Err    *ParseError // The problem and its location in the source
+	Action string      // What the parser did about it, e.g. "dropped cue"
+}
+
+// String returns the problem followed by the action taken.
+func (d Diagnostic) String() string {
+	return d.Err.Error() + " (" + d.Action + ")"
+}
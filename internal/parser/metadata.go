@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// ttmlPrefixes are the namespace prefixes that TTML output declares itself.
+var ttmlPrefixes = map[string]bool{"ttp": true, "tts": true, "ttm": true}
+
+// metadataState tracks the metadata element being parsed in the head.
+type metadataState struct {
+	open  []string // local names of the open elements, outermost first
+	text  *string  // field that receives character data
+	agent *Agent   // agent being parsed
+	raw   strings.Builder
+	depth int // open elements of the metadata being copied as raw XML
+}
+
+// metadataStart handles the start of an element that is part of the head
+// metadata and reports whether it did.
+func (h *ittHandler) metadataStart(name xml.Name, attrs []xml.Attr) bool {
+	m := &h.meta
+	if m.depth > 0 {
+		m.raw.Write(h.event)
+		m.depth++
+		return true
+	}
+	parent := ""
+	if len(m.open) > 0 {
+		parent = m.open[len(m.open)-1]
+	} else if !h.inHead || !isMetadata(name) {
+		return false
+	}
+
+	md := &h.doc.Metadata
+	switch {
+	case name.Space == "" && name.Local == "metadata":
+		for _, attr := range attrs {
+			if attr.Name.Space != "ttm" {
+				continue
+			}
+			switch attr.Name.Local {
+			case "agent":
+				md.Agent = attr.Value
+			case "role":
+				md.Role = attr.Value
+			}
+		}
+	case parent == "agent" && name.Space == "ttm" && name.Local == "name":
+		m.agent.Names = append(m.agent.Names, AgentName{Type: attrValue(attrs, "type")})
+		m.text = &m.agent.Names[len(m.agent.Names)-1].Name
+	case parent == "agent" && name.Space == "ttm" && name.Local == "actor":
+		m.agent.Actor = attrValue(attrs, "agent")
+	case parent == "agent":
+		// Other content of an agent is not kept.
+	case name.Space == "ttm" && name.Local == "agent":
+		m.agent = &Agent{ID: attrValue(attrs, "id"), Type: attrValue(attrs, "type")}
+	case name.Space == "ttm" && name.Local == "title" && md.Title == "":
+		m.text = &md.Title
+	case name.Space == "ttm" && name.Local == "desc" && md.Desc == "":
+		m.text = &md.Desc
+	case name.Space == "ttm" && name.Local == "copyright" && md.Copyright == "":
+		m.text = &md.Copyright
+	default:
+		m.raw.Reset()
+		m.raw.Write(h.event)
+		m.depth = 1
+		return true
+	}
+	m.open = append(m.open, name.Local)
+	return true
+}
+
+// metadataEnd handles the end of an element that is part of the head
+// metadata and reports whether it did.
+func (h *ittHandler) metadataEnd() bool {
+	m := &h.meta
+	if m.depth > 0 {
+		// The end of a self-closing tag has no event of its own.
+		if !h.selfClosing {
+			m.raw.Write(h.event)
+		}
+		if m.depth--; m.depth == 0 {
+			h.doc.Metadata.Other = append(h.doc.Metadata.Other, m.raw.String())
+		}
+		return true
+	}
+	if len(m.open) == 0 {
+		return false
+	}
+	if m.text != nil {
+		*m.text = strings.TrimSpace(*m.text)
+		m.text = nil
+	}
+	if m.open[len(m.open)-1] == "agent" && m.agent != nil {
+		h.doc.Metadata.Agents = append(h.doc.Metadata.Agents, *m.agent)
+		m.agent = nil
+	}
+	m.open = m.open[:len(m.open)-1]
+	return true
+}
+
+// metadataText handles character data inside the head metadata and reports
+// whether it did.
+func (h *ittHandler) metadataText(c []byte) bool {
+	m := &h.meta
+	if m.depth > 0 {
+		m.raw.Write(h.event)
+		return true
+	}
+	if len(m.open) == 0 {
+		return false
+	}
+	if m.text != nil {
+		*m.text += string(c)
+	}
+	return true
+}
+
+// AgentName returns the name to show for the agent with the given ID: its
+// first ttm:name, or the ID itself if the agent has no name or is not
+// defined.
+func (m Metadata) AgentName(id string) string {
+	for _, agent := range m.Agents {
+		if agent.ID == id && len(agent.Names) > 0 && agent.Names[0].Name != "" {
+			return agent.Names[0].Name
+		}
+	}
+	return id
+}
+
+// Speakers returns the names of the agents with the given IDs, as given by
+// AgentName, joined by ", ", or "" if there are none.
+func (m Metadata) Speakers(agents []string) string {
+	names := make([]string, len(agents))
+	for i, id := range agents {
+		names[i] = m.AgentName(id)
+	}
+	return strings.Join(names, ", ")
+}
+
+// isMetadata reports whether name is a <metadata> element or a metadata
+// element allowed directly in the head.
+func isMetadata(name xml.Name) bool {
+	return name.Space == "" && name.Local == "metadata" || name.Space == "ttm"
+}
+
+// attrValue returns the value of the attribute with the given local name.
+func attrValue(attrs []xml.Attr, local string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
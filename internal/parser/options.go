@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// DefaultMinDuration is the duration given to cues repaired with RepairExtend
+// when Options.MinDuration is not set.
+const DefaultMinDuration = time.Second
+
+// RepairStrategy selects what lenient parsing does with a cue whose begin
+// time is not before its end time.
+type RepairStrategy int
+
+const (
+	// RepairDrop removes the cue from the document.
+	RepairDrop RepairStrategy = iota
+	// RepairSwap exchanges begin and end. Cues with equal times are extended
+	// as with RepairExtend.
+	RepairSwap
+	// RepairExtend moves the end to begin plus the minimum duration.
+	RepairExtend
+)
+
+// String returns the name used for the strategy on the command line.
+func (s RepairStrategy) String() string {
+	switch s {
+	case RepairDrop:
+		return "drop"
+	case RepairSwap:
+		return "swap"
+	case RepairExtend:
+		return "extend"
+	}
+	return fmt.Sprintf("RepairStrategy(%d)", int(s))
+}
+
+// ParseRepairStrategy returns the strategy named s ("drop", "swap" or "extend").
+func ParseRepairStrategy(s string) (RepairStrategy, error) {
+	for _, rs := range []RepairStrategy{RepairDrop, RepairSwap, RepairExtend} {
+		if rs.String() == s {
+			return rs, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown repair strategy %q, expected drop, swap or extend", s)
+}
+
+// ReferencePolicy selects what the parser does with style and region
+// references that have no definition in the document head.
+type ReferencePolicy int
+
+const (
+	// ReferenceKeep passes unknown references through unchanged. When
+	// Options.CollectErrors is set in strict mode, it acts like
+	// ReferenceFail instead, so that unknown references are listed with the
+	// other errors.
+	ReferenceKeep ReferencePolicy = iota
+	// ReferenceDrop removes unknown references.
+	ReferenceDrop
+	// ReferenceDefault replaces unknown references with Options.DefaultStyle
+	// or Options.DefaultRegion, or drops them if no default is defined.
+	ReferenceDefault
+	// ReferenceFail makes unknown references a parse error.
+	ReferenceFail
+)
+
+// String returns the name used for the policy on the command line.
+func (p ReferencePolicy) String() string {
+	switch p {
+	case ReferenceKeep:
+		return "keep"
+	case ReferenceDrop:
+		return "drop"
+	case ReferenceDefault:
+		return "default"
+	case ReferenceFail:
+		return "fail"
+	}
+	return fmt.Sprintf("ReferencePolicy(%d)", int(p))
+}
+
+// ParseReferencePolicy returns the policy named s ("keep", "drop", "default"
+// or "fail").
+func ParseReferencePolicy(s string) (ReferencePolicy, error) {
+	for _, p := range []ReferencePolicy{ReferenceKeep, ReferenceDrop, ReferenceDefault, ReferenceFail} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reference policy %q, expected keep, drop, default or fail", s)
+}
+
+// Options controls how ParseITTWithOptions treats problems in the source.
+// The zero value selects strict parsing, which fails on the first invalid cue.
+type Options struct {
+	// Lenient repairs or drops invalid cues instead of failing. Every repair
+	// is recorded in ITTDocument.Diagnostics.
+	Lenient bool
+	// CollectErrors makes strict parsing continue after an error and return
+	// every problem found, joined with errors.Join. It also reports malformed
+	// begin and end timecodes, root parameters and language tags, which strict
+	// parsing otherwise tolerates with a warning or diagnostic, and unless
+	// References says otherwise, references to undefined styles or regions.
+	// Ignored in lenient mode.
+	CollectErrors bool
+	// References selects how references to undefined styles and regions are
+	// handled. Every unknown reference is recorded in ITTDocument.Diagnostics
+	// unless the policy is ReferenceFail.
+	References ReferencePolicy
+	// DefaultStyle and DefaultRegion name the definitions that replace unknown
+	// references under ReferenceDefault.
+	DefaultStyle  string
+	DefaultRegion string
+	// Repair selects how invalid cues are handled in lenient mode.
+	Repair RepairStrategy
+	// MinDuration is the duration used by RepairExtend. Defaults to
+	// DefaultMinDuration.
+	MinDuration time.Duration
+}
+
+// referencePolicy returns the effective reference policy. Collecting errors
+// in strict mode turns unknown references into errors unless a policy that
+// resolves them was chosen.
+func (o Options) referencePolicy() ReferencePolicy {
+	if o.References == ReferenceKeep && o.CollectErrors && !o.Lenient {
+		return ReferenceFail
+	}
+	return o.References
+}
+
+// minDurationMs returns the configured minimum duration in milliseconds.
+func (o Options) minDurationMs() *big.Rat {
+	d := o.MinDuration
+	if d <= 0 {
+		d = DefaultMinDuration
+	}
+	return big.NewRat(d.Microseconds(), 1000)
+}
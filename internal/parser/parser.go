@@ -3,14 +3,21 @@ package parser
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/lang"
 	"github.com/mediafellows/ittconv/internal/timecode"
+	"github.com/mediafellows/ittconv/internal/units"
 
 	"github.com/orisano/gosax"
 )
@@ -27,8 +34,15 @@ func init() {
 	}))
 }
 
-// ParseITT parses an ITT XML string into an ITTDocument structure.
+// ParseITT parses an ITT XML string into an ITTDocument structure using
+// strict parsing.
 func ParseITT(ittSource string) (*ITTDocument, error) {
+	return ParseITTWithOptions(ittSource, Options{})
+}
+
+// ParseITTWithOptions parses an ITT XML string into an ITTDocument structure
+// according to opts.
+func ParseITTWithOptions(ittSource string, opts Options) (*ITTDocument, error) {
 	logger.Debug("Starting ITT parsing")
 	doc := &ITTDocument{
 		Styles:  make(map[string]Style),
@@ -40,7 +54,8 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 	r := gosax.NewReader(reader)
 	r.EmitSelfClosingTag = true // Ensure self-closing tags are recognized
 
-	handler := &ittHandler{doc: doc, reader: r} // Pass reader to handler
+	handler := &ittHandler{doc: doc, reader: r, opts: opts} // Pass reader to handler
+	pos := Position{Line: 1, Column: 1}
 
 	for {
 		e, err := r.Event()
@@ -48,32 +63,43 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading XML event: %w", err)
+			return nil, handler.abort(newParseError(pos, "", "", errs.New(errs.ErrMalformedXML, "error reading XML event: %w", err)))
+		}
+
+		// Remember where this event starts before moving past it. Self-closing
+		// tags are reported twice (start and synthetic end) with the same bytes,
+		// so only the start event consumes input.
+		handler.pos = pos
+		// Copied, as gosax unescapes attribute values and text in place.
+		handler.event = append(handler.event[:0], e.Bytes...)
+		handler.selfClosing = e.Type() == gosax.EventEnd && bytes.HasSuffix(e.Bytes, []byte("/>"))
+		if !handler.selfClosing {
+			pos = pos.advance(e.Bytes)
 		}
 
 		switch e.Type() {
 		case gosax.EventStart:
 			startElement, err := gosax.StartElement(e.Bytes)
 			if err != nil {
-				return nil, fmt.Errorf("error parsing start element: %w", err)
+				return nil, handler.abort(newParseError(handler.pos, "", "", errs.New(errs.ErrMalformedXML, "error parsing start element: %w", err)))
 			}
-			logger.Debug("Handling start element", "name", startElement.Name.Local)
+			logger.Debug("Handling start element", "name", startElement.Name.Local, "line", handler.pos.Line)
 			if err := handler.handleStartElement(startElement.Name, startElement.Attr); err != nil {
-				return nil, err
+				return nil, handler.abort(locate(err, handler.pos, startElement.Name.Local))
 			}
 		case gosax.EventEnd:
 			endElement := gosax.EndElement(e.Bytes)
 			logger.Debug("Handling end element", "name", endElement.Name.Local)
 			if err := handler.handleEndElement(endElement.Name); err != nil {
-				return nil, err
+				return nil, handler.abort(locate(err, handler.pos, endElement.Name.Local))
 			}
 		case gosax.EventText:
 			charData, err := gosax.CharData(e.Bytes)
 			if err != nil {
-				return nil, fmt.Errorf("error parsing character data: %w", err)
+				return nil, handler.abort(newParseError(handler.pos, "", "", errs.New(errs.ErrMalformedXML, "error parsing character data: %w", err)))
 			}
 			if err := handler.handleCharData(charData); err != nil {
-				return nil, err
+				return nil, handler.abort(locate(err, handler.pos, ""))
 			}
 			// Add other event types if needed (e.g., comments, processing instructions)
 		}
@@ -81,13 +107,13 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 
 	// Post-processing: Convert SMPTE timecodes to milliseconds
 	if doc.FrameRate == "" {
-		return nil, fmt.Errorf("frameRate attribute missing in <tt> tag")
+		return nil, handler.abort(newParseError(handler.ttPos, "tt", "frameRate", errs.New(errs.ErrMissingFrameRate, "frameRate attribute missing in <tt> tag")))
 	}
 	fr := doc.FrameRateValue
 	if fr == nil {
 		baseFrameRate, err := timecode.NewFrameRate(doc.FrameRate)
 		if err != nil {
-			return nil, fmt.Errorf("invalid frame rate '%s': %w", doc.FrameRate, err)
+			return nil, handler.abort(newParseError(handler.ttPos, "tt", "frameRate", errs.New(errs.ErrInvalidFrameRate, "invalid frame rate '%s': %w", doc.FrameRate, err)))
 		}
 		if doc.FrameRateMultiplierNum > 0 && doc.FrameRateMultiplierDen > 0 {
 			if baseFrameRate.IsInt() {
@@ -103,12 +129,16 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 	}
 	logger.Debug("Successfully parsed framerate", "framerate", doc.FrameRate)
 
+	cues := doc.Cues[:0]
 	for i := range doc.Cues {
 		cue := &doc.Cues[i]
 		if cue.BeginTimecode != nil {
 			ms, err := cue.BeginTimecode.ToMilliseconds(fr)
 			if err != nil {
-				return nil, fmt.Errorf("error converting begin timecode '%v': %w", cue.BeginTimecode, err)
+				if err := handler.fail(newParseError(cue.Pos, "p", "begin", errs.New(errs.ErrInvalidTimecode, "error converting begin timecode '%v': %w", cue.BeginTimecode, err))); err != nil {
+					return nil, err
+				}
+				continue
 			}
 			cue.Begin = ms
 			logger.Debug("Converted begin timecode", "smpte", cue.BeginTimecode, "ms", ms)
@@ -116,7 +146,10 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 		if cue.EndTimecode != nil {
 			ms, err := cue.EndTimecode.ToMilliseconds(fr)
 			if err != nil {
-				return nil, fmt.Errorf("error converting end timecode '%v': %w", cue.EndTimecode, err)
+				if err := handler.fail(newParseError(cue.Pos, "p", "end", errs.New(errs.ErrInvalidTimecode, "error converting end timecode '%v': %w", cue.EndTimecode, err))); err != nil {
+					return nil, err
+				}
+				continue
 			}
 			cue.End = ms
 			logger.Debug("Converted end timecode", "smpte", cue.EndTimecode, "ms", ms)
@@ -142,14 +175,66 @@ func ParseITT(ittSource string) (*ITTDocument, error) {
 
 		// Validate begin < end
 		if cue.Begin != nil && cue.End != nil && cue.Begin.Cmp(cue.End) >= 0 {
-			return nil, fmt.Errorf("invalid cue timing: begin time (%s) is not less than end time (%s) for cue ID %s",
-				cue.Begin.String(), cue.End.String(), cue.ID)
+			pe := newParseError(cue.Pos, "p", "", errs.New(errs.ErrCueTimingInverted, "invalid cue timing: begin time (%s) is not less than end time (%s) for cue ID %s",
+				cue.Begin.String(), cue.End.String(), cue.ID))
+			if !opts.Lenient {
+				if err := handler.fail(pe); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			keep, action := repairCue(cue, opts)
+			logger.Debug("Repaired invalid cue", "id", cue.ID, "line", cue.Pos.Line, "action", action)
+			doc.Diagnostics = append(doc.Diagnostics, Diagnostic{Err: pe, Action: action})
+			if !keep {
+				continue
+			}
 		}
+		cues = append(cues, *cue)
 	}
-
+	doc.Cues = cues
+
+	if len(handler.errs) > 0 {
+		// Report problems in source order rather than in the order the
+		// parsing passes found them.
+		sort.SliceStable(handler.errs, func(i, j int) bool {
+			return errorOffset(handler.errs[i]) < errorOffset(handler.errs[j])
+		})
+		return nil, errors.Join(handler.errs...)
+	}
+	sort.SliceStable(doc.Diagnostics, func(i, j int) bool {
+		return errorOffset(doc.Diagnostics[i].Err) < errorOffset(doc.Diagnostics[j].Err)
+	})
 	return doc, nil
 }
 
+// errorOffset returns the byte offset in the source at which err was found.
+func errorOffset(err error) int {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return pe.Offset
+	}
+	return 0
+}
+
+// repairCue fixes the timing of a cue whose begin is not before its end,
+// following opts.Repair. It reports whether the cue should be kept and a
+// description of what was done.
+func repairCue(cue *Cue, opts Options) (bool, string) {
+	switch opts.Repair {
+	case RepairSwap:
+		if cue.Begin.Cmp(cue.End) != 0 {
+			cue.Begin, cue.End = cue.End, cue.Begin
+			return true, "swapped begin and end"
+		}
+		fallthrough
+	case RepairExtend:
+		cue.End = new(big.Rat).Add(cue.Begin, opts.minDurationMs())
+		return true, fmt.Sprintf("extended end to %sms", cue.End.FloatString(3))
+	}
+	return false, "dropped cue"
+}
+
 type ittHandler struct {
 	doc           *ITTDocument
 	currentCue    *Cue
@@ -158,29 +243,230 @@ type ittHandler struct {
 	contentBuffer strings.Builder
 	inPElement    bool
 	inSpanElement bool
-	regionStack   []string
+	regionStack   []inheritedRegion
 	reader        *gosax.Reader
 	offsetStack   []*big.Rat
 	frameRate     *timecode.FrameRate
+	pos           Position // Location of the event being handled
+	ttPos         Position // Location of the <tt> start tag
+	opts          Options
+	errs          []error     // Errors collected when Options.CollectErrors is set
+	cueErr        *ParseError // First problem found on the current <p> in lenient mode
+	preserve      []bool      // xml:space="preserve" in effect, one entry per open element
+	langs         []string    // xml:lang in effect, one entry per open element
+	pendingSpace  bool        // collapsed whitespace not yet written to the cue text
+	skipSpace     bool        // whitespace collapses into the line start or a space already written
+
+	inHead      bool
+	meta        metadataState
+	event       []byte // Source bytes of the event being handled
+	selfClosing bool   // The event is the end of a self-closing tag, which has the bytes of its start
+}
+
+// pushSpace records the xml:space value in effect for an element, which is
+// inherited from its parent unless the element sets its own.
+func (h *ittHandler) pushSpace(attrs []xml.Attr) {
+	preserve := len(h.preserve) > 0 && h.preserve[len(h.preserve)-1]
+	for _, attr := range attrs {
+		if attr.Name.Local == "space" {
+			preserve = attr.Value == "preserve"
+		}
+	}
+	h.preserve = append(h.preserve, preserve)
+}
+
+// popSpace drops the xml:space value of the element being closed.
+func (h *ittHandler) popSpace() {
+	if len(h.preserve) > 0 {
+		h.preserve = h.preserve[:len(h.preserve)-1]
+	}
+}
+
+// pushLang records the xml:lang in effect for element, which is inherited
+// from its parent unless the element sets its own. A tag that is not valid
+// BCP 47 is kept as written and recorded as a diagnostic.
+func (h *ittHandler) pushLang(element string, attrs []xml.Attr) {
+	tag := h.lang()
+	for _, attr := range attrs {
+		if attr.Name.Local != "lang" {
+			continue
+		}
+		normalized, err := lang.Normalize(attr.Value)
+		if err != nil {
+			h.tolerate(newParseError(h.pos, element, "lang", err), "kept language")
+			normalized = attr.Value
+		}
+		tag = normalized
+	}
+	h.langs = append(h.langs, tag)
+}
+
+// popLang drops the xml:lang of the element being closed.
+func (h *ittHandler) popLang() {
+	if len(h.langs) > 0 {
+		h.langs = h.langs[:len(h.langs)-1]
+	}
+}
+
+// lang returns the xml:lang in effect.
+func (h *ittHandler) lang() string {
+	if len(h.langs) == 0 {
+		return ""
+	}
+	return h.langs[len(h.langs)-1]
+}
+
+// writeText appends character data to the cue text. With xml:space="default"
+// every run of whitespace collapses to one space and whitespace at the start
+// and end of a line is removed, as a TTML presentation processor would.
+// With xml:space="preserve" spaces are kept and line feeds become line
+// breaks.
+func (h *ittHandler) writeText(c []byte) error {
+	if len(h.preserve) > 0 && h.preserve[len(h.preserve)-1] {
+		h.flushSpace()
+		for i, line := range bytes.Split(c, []byte("\n")) {
+			if i > 0 {
+				h.contentBuffer.WriteString("<br/>")
+			}
+			if err := xml.EscapeText(&h.contentBuffer, line); err != nil {
+				return err
+			}
+		}
+		h.skipSpace = false
+		return nil
+	}
+	for len(c) > 0 {
+		if isXMLSpace(rune(c[0])) {
+			h.pendingSpace = true
+			c = c[1:]
+			continue
+		}
+		end := bytes.IndexFunc(c, isXMLSpace)
+		if end < 0 {
+			end = len(c)
+		}
+		h.flushSpace()
+		if err := xml.EscapeText(&h.contentBuffer, c[:end]); err != nil {
+			return err
+		}
+		h.skipSpace = false
+		c = c[end:]
+	}
+	return nil
+}
+
+// flushSpace writes a pending collapsed space unless the line is empty or
+// already ends in a space.
+func (h *ittHandler) flushSpace() {
+	if h.pendingSpace && !h.skipSpace {
+		h.contentBuffer.WriteByte(' ')
+		h.skipSpace = true
+	}
+	h.pendingSpace = false
+}
+
+// isXMLSpace reports whether r is XML whitespace.
+func isXMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// fail records err and returns nil when errors are being collected, so that
+// parsing can continue. Otherwise it returns err unchanged.
+func (h *ittHandler) fail(err error) error {
+	if h.opts.CollectErrors && !h.opts.Lenient {
+		h.errs = append(h.errs, err)
+		return nil
+	}
+	return err
+}
+
+// abort returns err joined with any errors collected so far.
+func (h *ittHandler) abort(err error) error {
+	if len(h.errs) == 0 {
+		return err
+	}
+	return errors.Join(append(h.errs, err)...)
+}
+
+// advance returns the position reached after consuming b.
+func (p Position) advance(b []byte) Position {
+	p.Offset += len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			p.Column += utf8.RuneCount(b)
+			break
+		}
+		p.Line++
+		p.Column = 1
+		b = b[i+1:]
+	}
+	return p
+}
+
+// locate attaches pos and element to err unless it already carries a location.
+func locate(err error, pos Position, element string) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return newParseError(pos, element, "", err)
 }
 
 func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
+	h.pushSpace(attrs)
+	h.pushLang(name.Local, attrs)
+	if !h.inPElement && h.metadataStart(name, attrs) {
+		return nil
+	}
 	if h.inPElement {
-		// If we are inside a <p> element, treat everything as raw content
+		// If we are inside a <p> element, treat everything as raw content.
+		// A collapsed space before an element belongs in front of it.
+		if name.Local != "br" {
+			h.flushSpace()
+		}
 		var buf bytes.Buffer
 		buf.WriteByte('<')
 		buf.WriteString(name.Local)
 		for _, attr := range attrs {
+			if attr.Name.Local == "space" {
+				// Whitespace handling is applied to the text itself.
+				continue
+			}
+			value := attr.Value
+			if attr.Name.Local == "lang" {
+				value = h.lang()
+			}
+			if name.Local == "span" && attr.Name.Local == "style" {
+				ids, err := h.resolveStyles(strings.Fields(value), "span")
+				if err != nil {
+					return err
+				}
+				if len(ids) == 0 {
+					continue
+				}
+				value = strings.Join(ids, " ")
+			}
+			if attr.Name.Space == "ttm" && (attr.Name.Local == "agent" || attr.Name.Local == "role") {
+				h.doc.HasSpeakers = true
+			}
 			buf.WriteByte(' ')
+			if attr.Name.Space == "tts" || attr.Name.Space == "ttm" || attr.Name.Space == "xml" {
+				// Inline styles such as tts:ruby, ttm:agent and xml:lang
+				// keep their namespace.
+				buf.WriteString(attr.Name.Space + ":")
+			}
 			buf.WriteString(attr.Name.Local)
 			buf.WriteString(`="`)
-			buf.WriteString(attr.Value)
+			buf.WriteString(value)
 			buf.WriteByte('"')
 		}
 
 		// Handle self-closing tags like <br/>
 		if name.Local == "br" {
 			buf.WriteString("/>")
+			h.pendingSpace = false
+			h.skipSpace = true
 		} else {
 			buf.WriteByte('>')
 		}
@@ -192,12 +478,13 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 
 	switch name.Local {
 	case "tt":
+		h.ttPos = h.pos
 		var frameRateMultiplier string
 		for _, attr := range attrs {
 			switch attr.Name.Local {
 			case "lang":
-				h.doc.Lang = attr.Value
-				logger.Debug("Parsed lang", "value", attr.Value)
+				h.doc.Lang = h.lang()
+				logger.Debug("Parsed lang", "value", h.doc.Lang)
 			case "timeBase":
 				h.doc.TimeBase = attr.Value
 				logger.Debug("Parsed timeBase", "value", attr.Value)
@@ -207,33 +494,41 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "frameRateMultiplier":
 				frameRateMultiplier = attr.Value
 				logger.Debug("Parsed frameRateMultiplier", "value", attr.Value)
+			case "extent":
+				h.doc.Extent = attr.Value
+				logger.Debug("Parsed extent", "value", attr.Value)
+			case "cellResolution":
+				h.doc.CellResolution = attr.Value
+				logger.Debug("Parsed cellResolution", "value", attr.Value)
+			case "pixelAspectRatio":
+				h.doc.PixelAspectRatio = attr.Value
+				logger.Debug("Parsed pixelAspectRatio", "value", attr.Value)
+			}
+			if attr.Name.Space == "xmlns" && !ttmlPrefixes[attr.Name.Local] {
+				if h.doc.Metadata.Namespaces == nil {
+					h.doc.Metadata.Namespaces = map[string]string{}
+				}
+				h.doc.Metadata.Namespaces[attr.Name.Local] = attr.Value
 			}
 		}
+		h.parseUnits()
 
 		if frameRateMultiplier != "" {
-			parts := strings.Fields(frameRateMultiplier)
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid frameRateMultiplier format: %s", frameRateMultiplier)
-			}
-			num, err := strconv.Atoi(parts[0])
+			num, den, err := parseFrameRateMultiplier(frameRateMultiplier)
 			if err != nil {
-				return fmt.Errorf("invalid frameRateMultiplier numerator %q: %w", parts[0], err)
-			}
-			den, err := strconv.Atoi(parts[1])
-			if err != nil {
-				return fmt.Errorf("invalid frameRateMultiplier denominator %q: %w", parts[1], err)
-			}
-			if num <= 0 || den <= 0 {
-				return fmt.Errorf("frameRateMultiplier values must be positive: %s", frameRateMultiplier)
+				if err := h.fail(newParseError(h.pos, "tt", "frameRateMultiplier", err)); err != nil {
+					return err
+				}
+			} else {
+				h.doc.FrameRateMultiplierNum = num
+				h.doc.FrameRateMultiplierDen = den
 			}
-			h.doc.FrameRateMultiplierNum = num
-			h.doc.FrameRateMultiplierDen = den
 		}
 
 		if h.doc.FrameRate != "" {
 			fr, err := timecode.NewFrameRate(h.doc.FrameRate)
 			if err != nil {
-				return fmt.Errorf("invalid frame rate '%s': %w", h.doc.FrameRate, err)
+				return newParseError(h.pos, "tt", "frameRate", errs.New(errs.ErrInvalidFrameRate, "invalid frame rate '%s': %w", h.doc.FrameRate, err))
 			}
 			if h.doc.FrameRateMultiplierNum > 0 && h.doc.FrameRateMultiplierDen > 0 {
 				if fr.IsInt() {
@@ -248,6 +543,8 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			h.doc.FrameRateValue = fr
 			logger.Debug("Computed effective framerate", "value", fr.String())
 		}
+	case "head":
+		h.inHead = true
 	case "body", "div":
 		regionFromAttr := ""
 		var beginAttr string
@@ -259,7 +556,15 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 				beginAttr = attr.Value
 			}
 		}
-		h.regionStack = append(h.regionStack, regionFromAttr)
+		region := inheritedRegion{set: regionFromAttr != ""}
+		if region.set {
+			id, err := h.resolveRegion(regionFromAttr, name.Local)
+			if err != nil {
+				return err
+			}
+			region.id = id
+		}
+		h.regionStack = append(h.regionStack, region)
 		if err := h.pushOffset(beginAttr, name.Local); err != nil {
 			return err
 		}
@@ -285,6 +590,24 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "color":
 				h.currentStyle.Color = attr.Value
 				logger.Debug("Parsed style color", "value", attr.Value)
+			case "backgroundColor":
+				h.currentStyle.BackgroundColor = attr.Value
+				logger.Debug("Parsed style backgroundColor", "value", attr.Value)
+			case "textDecoration":
+				h.currentStyle.TextDecoration = attr.Value
+				logger.Debug("Parsed style textDecoration", "value", attr.Value)
+			case "ruby":
+				h.currentStyle.Ruby = attr.Value
+				logger.Debug("Parsed style ruby", "value", attr.Value)
+			case "textCombine":
+				h.currentStyle.TextCombine = attr.Value
+				logger.Debug("Parsed style textCombine", "value", attr.Value)
+			case "direction":
+				h.currentStyle.Direction = attr.Value
+				logger.Debug("Parsed style direction", "value", attr.Value)
+			case "unicodeBidi":
+				h.currentStyle.UnicodeBidi = attr.Value
+				logger.Debug("Parsed style unicodeBidi", "value", attr.Value)
 			}
 		}
 		if h.currentStyle.ID != "" {
@@ -310,6 +633,12 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "displayAlign":
 				h.currentRegion.DisplayAlign = attr.Value
 				logger.Debug("Parsed region displayAlign", "value", attr.Value)
+			case "writingMode":
+				h.currentRegion.WritingMode = attr.Value
+				logger.Debug("Parsed region writingMode", "value", attr.Value)
+			case "direction":
+				h.currentRegion.Direction = attr.Value
+				logger.Debug("Parsed region direction", "value", attr.Value)
 			}
 		}
 		if h.currentRegion.ID != "" {
@@ -318,8 +647,13 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 		}
 	case "p":
 		h.inPElement = true
-		h.currentCue = &Cue{}
-		var pRegion string
+		h.pendingSpace = false
+		h.skipSpace = true
+		h.currentCue = &Cue{Pos: h.pos}
+		if l := h.lang(); l != h.doc.Lang {
+			h.currentCue.Lang = l
+		}
+		var pRegion, pDirection string
 		var hasPRegion bool
 
 		for _, attr := range attrs {
@@ -327,8 +661,9 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "begin":
 				tc, err := timecode.ParseSMPTETimecode(attr.Value)
 				if err != nil {
-					logger.Warn("Invalid begin timecode format", "value", attr.Value, "error", err)
-					// Continue parsing, but cue.BeginTimecode will be nil, handled later
+					if err := h.invalidCue(newParseError(h.pos, "p", "begin", err)); err != nil {
+						return err
+					}
 				} else {
 					h.currentCue.BeginTimecode = tc
 				}
@@ -336,7 +671,9 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "end":
 				tc, err := timecode.ParseSMPTETimecode(attr.Value)
 				if err != nil {
-					logger.Warn("Invalid end timecode format", "value", attr.Value, "error", err)
+					if err := h.invalidCue(newParseError(h.pos, "p", "end", err)); err != nil {
+						return err
+					}
 				} else {
 					h.currentCue.EndTimecode = tc
 				}
@@ -347,22 +684,53 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 			case "style":
 				h.currentCue.StyleIDs = strings.Fields(attr.Value)
 				logger.Debug("Parsed p style", "value", attr.Value)
+			case "direction":
+				pDirection = attr.Value
+				logger.Debug("Parsed p direction", "value", attr.Value)
+			case "agent":
+				h.currentCue.Agents = strings.Fields(attr.Value)
+				h.doc.HasSpeakers = true
+				logger.Debug("Parsed p agent", "value", attr.Value)
+			case "role":
+				h.currentCue.Role = attr.Value
+				h.doc.HasSpeakers = true
+				logger.Debug("Parsed p role", "value", attr.Value)
 			}
 		}
 
 		if hasPRegion {
-			h.currentCue.RegionID = pRegion
+			regionID, err := h.resolveRegion(pRegion, "p")
+			if err != nil {
+				return err
+			}
+			h.currentCue.RegionID = regionID
 		} else {
-			// Inherit from stack, finding the closest ancestor with a region
+			// Inherit from the closest ancestor with a region, which was
+			// resolved where it was set.
 			for i := len(h.regionStack) - 1; i >= 0; i-- {
-				if h.regionStack[i] != "" {
-					h.currentCue.RegionID = h.regionStack[i]
+				if h.regionStack[i].set {
+					h.currentCue.RegionID = h.regionStack[i].id
 					break
 				}
 			}
 		}
+		styleIDs, err := h.resolveStyles(h.currentCue.StyleIDs, "p")
+		if err != nil {
+			return err
+		}
+		h.currentCue.StyleIDs = styleIDs
+		// An inline direction wins over those of the styles, of which the
+		// last one referenced wins.
+		for _, id := range styleIDs {
+			if d := h.doc.Styles[id].Direction; d != "" {
+				h.currentCue.Direction = d
+			}
+		}
+		if pDirection != "" {
+			h.currentCue.Direction = pDirection
+		}
 		h.currentCue.Offset = h.currentOffset()
-		logger.Debug("Starting p element", "id", h.currentCue.ID, "region", h.currentCue.RegionID)
+		logger.Debug("Starting p element", "id", h.currentCue.ID, "region", h.currentCue.RegionID, "line", h.pos.Line)
 	case "span":
 		h.inSpanElement = true
 		// Handle span styles if needed, add to currentCue.StyleIDs
@@ -380,35 +748,199 @@ func (h *ittHandler) handleStartElement(name xml.Name, attrs []xml.Attr) error {
 	return nil
 }
 
-func (h *ittHandler) pushOffset(beginAttr string, elementName string) error {
-	var parent *big.Rat
-	if len(h.offsetStack) > 0 && h.offsetStack[len(h.offsetStack)-1] != nil {
-		parent = new(big.Rat).Set(h.offsetStack[len(h.offsetStack)-1])
+// inheritedRegion is the region set on a <body> or <div> for the paragraphs
+// inside it.
+type inheritedRegion struct {
+	id  string // resolved region ID, empty if the reference was dropped
+	set bool   // whether the element has a region attribute
+}
+
+// resolveRegion checks a region reference made by element and returns the
+// region ID to use, which is empty if the reference was dropped.
+func (h *ittHandler) resolveRegion(id string, element string) (string, error) {
+	if id == "" {
+		return id, nil
+	}
+	if _, ok := h.doc.Regions[id]; ok {
+		return id, nil
+	}
+	fallback := h.opts.DefaultRegion
+	if _, ok := h.doc.Regions[fallback]; !ok {
+		fallback = ""
 	}
+	return h.unknownReference(element, "region", id, fallback)
+}
 
-	offset := parent
-	if beginAttr != "" {
-		if h.frameRate == nil {
-			return fmt.Errorf("frameRate attribute missing in <tt> tag")
+// resolveStyles checks the style references made by element and returns the
+// style IDs to use.
+func (h *ittHandler) resolveStyles(ids []string, element string) ([]string, error) {
+	var resolved []string
+	for _, id := range ids {
+		if _, ok := h.doc.Styles[id]; !ok {
+			fallback := h.opts.DefaultStyle
+			if _, ok := h.doc.Styles[fallback]; !ok {
+				fallback = ""
+			}
+			var err error
+			if id, err = h.unknownReference(element, "style", id, fallback); err != nil {
+				return nil, err
+			}
 		}
-		tc, err := timecode.ParseSMPTETimecode(beginAttr)
-		if err != nil {
-			return fmt.Errorf("error parsing begin timecode '%s' on <%s>: %w", beginAttr, elementName, err)
+		if id != "" && !slices.Contains(resolved, id) {
+			resolved = append(resolved, id)
 		}
-		ms, err := tc.ToMilliseconds(h.frameRate)
-		if err != nil {
-			return fmt.Errorf("error converting begin timecode '%s' on <%s>: %w", beginAttr, elementName, err)
+	}
+	return resolved, nil
+}
+
+// unknownReference applies the reference policy to an undefined style or
+// region. It returns the ID to use in its place, which is empty if the
+// reference was dropped.
+func (h *ittHandler) unknownReference(element, attr, id, fallback string) (string, error) {
+	pe := newParseError(h.pos, element, attr, errs.New(errs.ErrUnknownReference, "unknown %s %q", attr, id))
+	action, replacement := "kept reference", id
+	switch h.opts.referencePolicy() {
+	case ReferenceFail:
+		return "", h.fail(pe)
+	case ReferenceDrop:
+		action, replacement = "dropped reference", ""
+	case ReferenceDefault:
+		action, replacement = "dropped reference", ""
+		if fallback != "" {
+			action, replacement = fmt.Sprintf("replaced with %q", fallback), fallback
 		}
-		if offset == nil {
-			offset = new(big.Rat)
+	}
+	logger.Debug("Resolved unknown reference", "kind", attr, "id", id, "line", h.pos.Line, "action", action)
+	h.doc.Diagnostics = append(h.doc.Diagnostics, Diagnostic{Err: pe, Action: action})
+	return replacement, nil
+}
+
+// parseUnits parses the root parameters that lengths depend on. A malformed
+// parameter is dropped and keeps its default value.
+func (h *ittHandler) parseUnits() {
+	h.doc.Units = units.DefaultRoot()
+	params := []struct {
+		attr  string
+		value *string
+		parse func(string) error
+	}{
+		{"extent", &h.doc.Extent, func(s string) (err error) {
+			h.doc.Units.Extent, err = units.ParseExtent(s)
+			return err
+		}},
+		{"cellResolution", &h.doc.CellResolution, func(s string) (err error) {
+			h.doc.Units.CellResolution, err = units.ParseCellResolution(s)
+			return err
+		}},
+		{"pixelAspectRatio", &h.doc.PixelAspectRatio, func(s string) (err error) {
+			h.doc.Units.PixelAspectRatio, err = units.ParsePixelAspectRatio(s)
+			return err
+		}},
+	}
+	for _, p := range params {
+		if *p.value == "" {
+			continue
+		}
+		defaults := h.doc.Units
+		if err := p.parse(*p.value); err != nil {
+			h.doc.Units = defaults
+			*p.value = ""
+			h.tolerate(newParseError(h.pos, "tt", p.attr, err), "used the default "+p.attr)
 		}
-		offset.Add(offset, ms)
+	}
+}
+
+// tolerate handles a malformed attribute that parsing can do without, such
+// as a root parameter or a language tag. Collecting errors in strict mode
+// records it as an error. Otherwise it is recorded in ITTDocument.Diagnostics
+// with action and parsing continues.
+func (h *ittHandler) tolerate(pe *ParseError, action string) {
+	if h.opts.CollectErrors && !h.opts.Lenient {
+		h.errs = append(h.errs, pe)
+		return
+	}
+	logger.Debug("Tolerated invalid attribute", "element", pe.Element, "attribute", pe.Attr, "line", pe.Line, "action", action)
+	h.doc.Diagnostics = append(h.doc.Diagnostics, Diagnostic{Err: pe, Action: action})
+}
+
+// parseFrameRateMultiplier parses a "num den" frameRateMultiplier value.
+func parseFrameRateMultiplier(s string) (int, int, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return 0, 0, errs.New(errs.ErrInvalidFrameRate, "invalid frameRateMultiplier format: %s", s)
+	}
+	num, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, errs.New(errs.ErrInvalidFrameRate, "invalid frameRateMultiplier numerator %q: %w", parts[0], err)
+	}
+	den, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, errs.New(errs.ErrInvalidFrameRate, "invalid frameRateMultiplier denominator %q: %w", parts[1], err)
+	}
+	if num <= 0 || den <= 0 {
+		return 0, 0, errs.New(errs.ErrInvalidFrameRate, "frameRateMultiplier values must be positive: %s", s)
+	}
+	return num, den, nil
+}
+
+func (h *ittHandler) pushOffset(beginAttr string, elementName string) error {
+	var parent *big.Rat
+	if len(h.offsetStack) > 0 && h.offsetStack[len(h.offsetStack)-1] != nil {
+		parent = new(big.Rat).Set(h.offsetStack[len(h.offsetStack)-1])
 	}
 
+	offset, err := h.elementOffset(parent, beginAttr, elementName)
+	if err != nil {
+		// Keep the stack balanced so parsing can continue when collecting errors.
+		h.offsetStack = append(h.offsetStack, parent)
+		return h.fail(err)
+	}
 	h.offsetStack = append(h.offsetStack, offset)
 	return nil
 }
 
+// elementOffset adds the begin attribute of a <body> or <div> to the
+// inherited parent offset.
+func (h *ittHandler) elementOffset(parent *big.Rat, beginAttr string, elementName string) (*big.Rat, error) {
+	if beginAttr == "" {
+		return parent, nil
+	}
+	if h.frameRate == nil {
+		return nil, newParseError(h.pos, elementName, "begin", errs.New(errs.ErrMissingFrameRate, "frameRate attribute missing in <tt> tag"))
+	}
+	tc, err := timecode.ParseSMPTETimecode(beginAttr)
+	if err != nil {
+		return nil, newParseError(h.pos, elementName, "begin", errs.New(errs.ErrInvalidTimecode, "error parsing begin timecode '%s' on <%s>: %w", beginAttr, elementName, err))
+	}
+	ms, err := tc.ToMilliseconds(h.frameRate)
+	if err != nil {
+		return nil, newParseError(h.pos, elementName, "begin", errs.New(errs.ErrInvalidTimecode, "error converting begin timecode '%s' on <%s>: %w", beginAttr, elementName, err))
+	}
+	offset := new(big.Rat)
+	if parent != nil {
+		offset.Set(parent)
+	}
+	return offset.Add(offset, ms), nil
+}
+
+// invalidCue handles a malformed begin or end on the <p> being parsed.
+// Lenient parsing remembers it so the cue can be dropped once it ends, and
+// collecting errors records it. Otherwise the attribute is ignored with a
+// warning and the cue is kept.
+func (h *ittHandler) invalidCue(pe *ParseError) error {
+	switch {
+	case h.opts.Lenient:
+		if h.cueErr == nil {
+			h.cueErr = pe
+		}
+		return nil
+	case h.opts.CollectErrors:
+		return h.fail(pe)
+	}
+	logger.Warn("Invalid timecode format", "attribute", pe.Attr, "line", pe.Line, "error", pe.Err)
+	return nil
+}
+
 func (h *ittHandler) currentOffset() *big.Rat {
 	if len(h.offsetStack) == 0 || h.offsetStack[len(h.offsetStack)-1] == nil {
 		return nil
@@ -417,14 +949,23 @@ func (h *ittHandler) currentOffset() *big.Rat {
 }
 
 func (h *ittHandler) handleEndElement(name xml.Name) error {
+	defer h.popSpace()
+	defer h.popLang()
+	if h.metadataEnd() {
+		return nil
+	}
 	if name.Local == "p" {
-		if h.currentCue != nil {
+		if h.cueErr != nil {
+			logger.Debug("Dropped invalid cue", "id", h.currentCue.ID, "line", h.cueErr.Line)
+			h.doc.Diagnostics = append(h.doc.Diagnostics, Diagnostic{Err: h.cueErr, Action: "dropped cue"})
+		} else if h.currentCue != nil {
 			h.currentCue.Content = h.contentBuffer.String()
 			h.doc.Cues = append(h.doc.Cues, *h.currentCue)
 			logger.Debug("Finalized cue", "id", h.currentCue.ID, "content", h.currentCue.Content)
 		}
 		h.inPElement = false
 		h.currentCue = nil
+		h.cueErr = nil
 		h.contentBuffer.Reset()
 		return nil
 	}
@@ -442,6 +983,8 @@ func (h *ittHandler) handleEndElement(name xml.Name) error {
 	}
 
 	switch name.Local {
+	case "head":
+		h.inHead = false
 	case "span":
 		h.inSpanElement = false
 	case "body", "div":
@@ -456,10 +999,11 @@ func (h *ittHandler) handleEndElement(name xml.Name) error {
 }
 
 func (h *ittHandler) handleCharData(c xml.CharData) error {
+	if h.metadataText(c) {
+		return nil
+	}
 	if h.inPElement || h.inSpanElement {
-		if err := xml.EscapeText(&h.contentBuffer, c); err != nil {
-			return err
-		}
+		return h.writeText(c)
 	}
 	return nil
 }
@@ -1,12 +1,18 @@
 package parser
 
 import (
+	"errors"
 	"io/ioutil"
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mediafellows/ittconv/internal/errs"
 	"github.com/mediafellows/ittconv/internal/timecode"
+	"github.com/mediafellows/ittconv/internal/units"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestParseITT_Valid(t *testing.T) {
@@ -84,6 +90,42 @@ func TestParseITT_InvalidTimeRange(t *testing.T) {
 	if !strings.Contains(err.Error(), "is not less than end time") {
 		t.Errorf("Expected error message about invalid time range, but got: %v", err)
 	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a *ParseError, got %T", err)
+	}
+	if pe.Line != 8 || pe.Column != 5 || pe.Element != "p" {
+		t.Errorf("Expected error located at line 8, column 5 on <p>, got line %d, column %d on <%s>", pe.Line, pe.Column, pe.Element)
+	}
+}
+
+func TestParseITT_Positions(t *testing.T) {
+	ittSource, err := ioutil.ReadFile("../../testdata/valid_input.itt")
+	if err != nil {
+		t.Fatalf("Failed to read test fixture: %v", err)
+	}
+
+	doc, err := ParseITT(string(ittSource))
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+
+	wantLines := []int{18, 21, 24}
+	for i, cue := range doc.Cues {
+		if cue.Pos.Line != wantLines[i] || cue.Pos.Column != 7 {
+			t.Errorf("Cue %d: expected position %d:7, got %d:%d", i, wantLines[i], cue.Pos.Line, cue.Pos.Column)
+		}
+	}
+
+	_, err = ParseITT("<tt ttp:frameRate=\"24\" ttp:frameRateMultiplier=\"1\">\n  <body/>\n</tt>")
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a *ParseError, got %v", err)
+	}
+	if pe.Line != 1 || pe.Column != 1 || pe.Element != "tt" || pe.Attr != "frameRateMultiplier" {
+		t.Errorf("Unexpected error location: %+v", pe)
+	}
 }
 
 func TestParseITT_DivBeginOffset(t *testing.T) {
@@ -128,3 +170,540 @@ func TestParseITT_DivBeginOffset(t *testing.T) {
 		t.Fatalf("Expected last cue begin %s, got %s", lastBeginMs.String(), lastCue.Begin.String())
 	}
 }
+
+func TestParseITT_Lenient(t *testing.T) {
+	ittSource, err := ioutil.ReadFile("../../testdata/invalid_time_range.itt")
+	if err != nil {
+		t.Fatalf("Failed to read test fixture: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      Options
+		wantCues  int
+		wantBegin int64
+		wantEnd   int64
+	}{
+		{name: "Drop", opts: Options{Lenient: true, Repair: RepairDrop}, wantCues: 0},
+		{name: "Swap", opts: Options{Lenient: true, Repair: RepairSwap}, wantCues: 1, wantBegin: 2000, wantEnd: 5000},
+		{name: "Extend", opts: Options{Lenient: true, Repair: RepairExtend, MinDuration: 1500 * time.Millisecond}, wantCues: 1, wantBegin: 5000, wantEnd: 6500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseITTWithOptions(string(ittSource), tt.opts)
+			if err != nil {
+				t.Fatalf("ParseITTWithOptions failed: %v", err)
+			}
+			if len(doc.Diagnostics) != 1 {
+				t.Fatalf("Expected 1 diagnostic, got %d", len(doc.Diagnostics))
+			}
+			if d := doc.Diagnostics[0]; d.Err.Line != 8 || !errors.Is(d.Err, errs.ErrCueTimingInverted) {
+				t.Errorf("Unexpected diagnostic: %s", d)
+			}
+			if len(doc.Cues) != tt.wantCues {
+				t.Fatalf("Expected %d cues, got %d", tt.wantCues, len(doc.Cues))
+			}
+			if tt.wantCues == 0 {
+				return
+			}
+			cue := doc.Cues[0]
+			if cue.Begin.Cmp(big.NewRat(tt.wantBegin, 1)) != 0 || cue.End.Cmp(big.NewRat(tt.wantEnd, 1)) != 0 {
+				t.Errorf("Expected %d-%d, got %s-%s", tt.wantBegin, tt.wantEnd, cue.Begin.String(), cue.End.String())
+			}
+		})
+	}
+}
+
+func TestParseITT_CollectErrors(t *testing.T) {
+	ittSource, err := ioutil.ReadFile("../../testdata/multiple_errors.itt")
+	if err != nil {
+		t.Fatalf("Failed to read test fixture: %v", err)
+	}
+
+	// Without CollectErrors the malformed timecode is ignored and parsing
+	// stops at the inverted cue.
+	_, err = ParseITT(string(ittSource))
+	if !errors.Is(err, errs.ErrCueTimingInverted) {
+		t.Fatalf("Expected ErrCueTimingInverted, got: %v", err)
+	}
+
+	_, err = ParseITTWithOptions(string(ittSource), Options{CollectErrors: true})
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected a joined error, got %T", err)
+	}
+
+	want := []struct {
+		line int
+		kind error
+	}{
+		{18, errs.ErrCueTimingInverted},
+		{19, errs.ErrInvalidTimecode},
+		{20, errs.ErrUnknownReference},
+		{21, errs.ErrUnknownReference},
+	}
+	got := joined.Unwrap()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(want), len(got), err)
+	}
+	for i, w := range want {
+		var pe *ParseError
+		if !errors.As(got[i], &pe) || pe.Line != w.line || !errors.Is(pe, w.kind) {
+			t.Errorf("Error %d: expected %v on line %d, got: %v", i, w.kind, w.line, got[i])
+		}
+	}
+
+	// Lenient parsing drops the broken cues instead.
+	doc, err := ParseITTWithOptions(string(ittSource), Options{Lenient: true})
+	if err != nil {
+		t.Fatalf("Lenient parsing failed: %v", err)
+	}
+	if len(doc.Cues) != 3 || len(doc.Diagnostics) != 4 {
+		t.Errorf("Expected 3 cues and 4 diagnostics, got %d and %d", len(doc.Cues), len(doc.Diagnostics))
+	}
+}
+
+func TestParseITT_MalformedTimecode(t *testing.T) {
+	const ittSource = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="25" xml:lang="en"><body><div>
+<p begin="00:00:0x:00" end="00:00:02:00">Bad</p>
+<p begin="00:00:03:00" end="00:00:04:00">Good</p>
+</div></body></tt>`
+
+	// By default the malformed begin is ignored and the cue kept.
+	doc, err := ParseITT(ittSource)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if len(doc.Cues) != 2 || doc.Cues[0].Begin != nil || doc.Cues[0].End.Cmp(big.NewRat(2000, 1)) != 0 {
+		t.Errorf("Expected both cues, the first without a begin, got %+v", doc.Cues)
+	}
+
+	if _, err := ParseITTWithOptions(ittSource, Options{CollectErrors: true}); !errors.Is(err, errs.ErrInvalidTimecode) {
+		t.Errorf("Expected ErrInvalidTimecode when collecting errors, got: %v", err)
+	}
+
+	doc, err = ParseITTWithOptions(ittSource, Options{Lenient: true})
+	if err != nil {
+		t.Fatalf("Lenient parsing failed: %v", err)
+	}
+	if len(doc.Cues) != 1 || len(doc.Diagnostics) != 1 || doc.Diagnostics[0].Action != "dropped cue" {
+		t.Errorf("Expected the bad cue to be dropped, got %d cues and %v", len(doc.Cues), doc.Diagnostics)
+	}
+}
+
+func TestParseITT_UnknownReferences(t *testing.T) {
+	const ittSource = `<tt ttp:frameRate="24">
+  <head>
+    <styling>
+      <style xml:id="s1" tts:color="white"/>
+    </styling>
+    <layout>
+      <region xml:id="bottom" tts:origin="10% 80%" tts:extent="80% 20%"/>
+    </layout>
+  </head>
+  <body region="nowhere">
+    <p begin="00:00:01:00" end="00:00:02:00" style="s1 missing">A <span style="gone">cue</span>.</p>
+  </body>
+</tt>`
+
+	tests := []struct {
+		name        string
+		opts        Options
+		wantRegion  string
+		wantStyles  []string
+		wantContent string
+		wantErr     bool
+	}{
+		{name: "Keep", opts: Options{}, wantRegion: "nowhere", wantStyles: []string{"s1", "missing"}, wantContent: `A <span style="gone">cue</span>.`},
+		{name: "Drop", opts: Options{References: ReferenceDrop}, wantRegion: "", wantStyles: []string{"s1"}, wantContent: `A <span>cue</span>.`},
+		{name: "Default", opts: Options{References: ReferenceDefault, DefaultStyle: "s1", DefaultRegion: "bottom"}, wantRegion: "bottom", wantStyles: []string{"s1"}, wantContent: `A <span style="s1">cue</span>.`},
+		{name: "Fail", opts: Options{References: ReferenceFail}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseITTWithOptions(ittSource, tt.opts)
+			if tt.wantErr {
+				var pe *ParseError
+				if !errors.Is(err, errs.ErrUnknownReference) || !errors.As(err, &pe) || pe.Line != 10 || pe.Element != "body" {
+					t.Fatalf("Expected ErrUnknownReference on <body> on line 10, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseITTWithOptions failed: %v", err)
+			}
+			if len(doc.Diagnostics) != 3 {
+				t.Errorf("Expected 3 diagnostics, got %d", len(doc.Diagnostics))
+			}
+			cue := doc.Cues[0]
+			if cue.RegionID != tt.wantRegion {
+				t.Errorf("Expected region %q, got %q", tt.wantRegion, cue.RegionID)
+			}
+			if strings.Join(cue.StyleIDs, " ") != strings.Join(tt.wantStyles, " ") {
+				t.Errorf("Expected styles %v, got %v", tt.wantStyles, cue.StyleIDs)
+			}
+			if cue.Content != tt.wantContent {
+				t.Errorf("Expected content %q, got %q", tt.wantContent, cue.Content)
+			}
+		})
+	}
+}
+
+func TestParseITT_InheritedUnknownRegion(t *testing.T) {
+	const ittSource = `<tt ttp:frameRate="24">
+  <body>
+    <div region="nowhere">
+      <p begin="00:00:01:00" end="00:00:02:00">One</p>
+      <p begin="00:00:03:00" end="00:00:04:00">Two</p>
+    </div>
+  </body>
+</tt>`
+
+	doc, err := ParseITTWithOptions(ittSource, Options{References: ReferenceDrop})
+	if err != nil {
+		t.Fatalf("ParseITTWithOptions failed: %v", err)
+	}
+	if len(doc.Diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %v", doc.Diagnostics)
+	}
+	if pe := doc.Diagnostics[0].Err; pe.Line != 3 || pe.Column != 5 || pe.Element != "div" {
+		t.Errorf("Expected the diagnostic on <div> at 3:5, got %v", pe)
+	}
+	for i, cue := range doc.Cues {
+		if cue.RegionID != "" {
+			t.Errorf("Cue %d: expected the region to be dropped, got %q", i, cue.RegionID)
+		}
+	}
+
+	_, err = ParseITTWithOptions(ittSource, Options{CollectErrors: true})
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 1 || !errors.Is(err, errs.ErrUnknownReference) {
+		t.Errorf("Expected a single ErrUnknownReference when collecting errors, got: %v", err)
+	}
+}
+
+func TestWhitespace(t *testing.T) {
+	const head = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:timeBase="smpte" ttp:frameRate="24"><body>`
+
+	tests := []struct {
+		name  string
+		body  string
+		wants []string
+	}{
+		{
+			name: "Default",
+			body: "<div><p begin=\"00:00:01:00\" end=\"00:00:02:00\">\n    Two   words\n    <span>and  a</span> span  <br/>\n   next\tline\n  </p></div>",
+			wants: []string{
+				`Two words <span>and a</span> span<br/>next line`,
+			},
+		},
+		{
+			name: "AcrossElements",
+			body: `<div><p begin="00:00:01:00" end="00:00:02:00">Hello <span> world </span> !</p></div>`,
+			wants: []string{
+				`Hello <span>world</span> !`,
+			},
+		},
+		{
+			name: "Preserve",
+			body: "<div><p xml:space=\"preserve\" begin=\"00:00:01:00\" end=\"00:00:02:00\">  Two  spaces\nand a line</p></div>",
+			wants: []string{
+				`  Two  spaces<br/>and a line`,
+			},
+		},
+		{
+			name: "Inherited",
+			body: "<div xml:space=\"preserve\"><p begin=\"00:00:01:00\" end=\"00:00:02:00\">a  b <span xml:space=\"default\"> c   d </span></p><p begin=\"00:00:03:00\" end=\"00:00:04:00\">e  f</p></div><div><p begin=\"00:00:05:00\" end=\"00:00:06:00\">g  h</p></div>",
+			wants: []string{
+				`a  b <span> c d</span>`,
+				`e  f`,
+				`g h`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseITT(head + tt.body + `</body></tt>`)
+			if err != nil {
+				t.Fatalf("ParseITT failed: %v", err)
+			}
+			var got []string
+			for _, cue := range doc.Cues {
+				got = append(got, cue.Content)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.wants, "\n") {
+				t.Errorf("Expected content:\n%s\ngot:\n%s", strings.Join(tt.wants, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseITT_RootUnits(t *testing.T) {
+	doc, err := ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:frameRate="24" tts:extent="1920px 1080px" ttp:cellResolution="40 20" ttp:pixelAspectRatio="1 1"><body/></tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if doc.Extent != "1920px 1080px" || doc.CellResolution != "40 20" || doc.PixelAspectRatio != "1 1" {
+		t.Errorf("Unexpected root parameters: %q, %q, %q", doc.Extent, doc.CellResolution, doc.PixelAspectRatio)
+	}
+	want := units.Root{Extent: [2]float64{1920, 1080}, CellResolution: [2]int{40, 20}, PixelAspectRatio: [2]int{1, 1}}
+	if doc.Units != want {
+		t.Errorf("Expected units %+v, got %+v", want, doc.Units)
+	}
+
+	doc, err = ParseITT(`<tt ttp:frameRate="24"><body/></tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if doc.Units != units.DefaultRoot() {
+		t.Errorf("Expected default units, got %+v", doc.Units)
+	}
+
+	doc, err = ParseITT(`<tt ttp:frameRate="24" tts:extent="auto"><body/></tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if doc.Extent != "auto" || doc.Units != units.DefaultRoot() || len(doc.Diagnostics) != 0 {
+		t.Errorf("Expected an auto extent with default units, got %q, %+v, %v", doc.Extent, doc.Units, doc.Diagnostics)
+	}
+
+	const invalid = `<tt ttp:frameRate="24" tts:extent="1920px 1080px" ttp:cellResolution="40">
+  <body/>
+</tt>`
+	doc, err = ParseITT(invalid)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	want = units.Root{Extent: [2]float64{1920, 1080}, CellResolution: units.DefaultCellResolution}
+	if doc.Units != want || doc.CellResolution != "" {
+		t.Errorf("Expected the default cell resolution, got %q, %+v", doc.CellResolution, doc.Units)
+	}
+	if len(doc.Diagnostics) != 1 || doc.Diagnostics[0].Action != "used the default cellResolution" {
+		t.Errorf("Expected one diagnostic for the cell resolution, got %v", doc.Diagnostics)
+	}
+
+	_, err = ParseITTWithOptions(invalid, Options{CollectErrors: true})
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, errs.ErrInvalidLength) {
+		t.Fatalf("Expected a *ParseError with ErrInvalidLength, got %v", err)
+	}
+	if pe.Element != "tt" || pe.Attr != "cellResolution" {
+		t.Errorf("Unexpected error location: %+v", pe)
+	}
+}
+
+func TestParseITT_Japanese(t *testing.T) {
+	doc, err := ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:frameRate="24">
+  <head>
+    <styling>
+      <style xml:id="base" tts:ruby="base"/>
+      <style xml:id="combo" tts:textCombine="all"/>
+    </styling>
+    <layout>
+      <region xml:id="right" tts:writingMode="tbrl"/>
+    </layout>
+  </head>
+  <body>
+    <div>
+      <p begin="00:00:01:00" end="00:00:02:00" region="right"><span tts:ruby="text">かんじ</span></p>
+    </div>
+  </body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if s := doc.Styles["base"]; s.Ruby != "base" {
+		t.Errorf("Expected ruby base, got %q", s.Ruby)
+	}
+	if s := doc.Styles["combo"]; s.TextCombine != "all" {
+		t.Errorf("Expected textCombine all, got %q", s.TextCombine)
+	}
+	if r := doc.Regions["right"]; r.WritingMode != "tbrl" {
+		t.Errorf("Expected writingMode tbrl, got %q", r.WritingMode)
+	}
+	if len(doc.Cues) != 1 || !strings.Contains(doc.Cues[0].Content, `tts:ruby="text"`) {
+		t.Errorf("Expected the tts prefix to be kept in cue content, got %+v", doc.Cues)
+	}
+}
+
+func TestITTDocument_Direction(t *testing.T) {
+	doc, err := ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:frameRate="24" xml:lang="ar">
+  <head>
+    <styling>
+      <style xml:id="ltr" tts:direction="ltr"/>
+    </styling>
+    <layout>
+      <region xml:id="latin" tts:direction="ltr"/>
+    </layout>
+  </head>
+  <body>
+    <div>
+      <p begin="00:00:01:00" end="00:00:02:00">مرحبا</p>
+      <p begin="00:00:02:00" end="00:00:03:00" region="latin">Hello</p>
+      <p begin="00:00:03:00" end="00:00:04:00" style="ltr">Hello</p>
+      <p begin="00:00:04:00" end="00:00:05:00" style="ltr" tts:direction="rtl" region="latin">مرحبا</p>
+    </div>
+  </body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	want := []string{"rtl", "ltr", "ltr", "rtl"}
+	for i, cue := range doc.Cues {
+		if got := doc.Direction(cue); got != want[i] {
+			t.Errorf("Cue %d: expected direction %s, got %s", i, want[i], got)
+		}
+	}
+	if s := doc.Styles["ltr"]; s.Direction != "ltr" {
+		t.Errorf("Expected style direction ltr, got %q", s.Direction)
+	}
+}
+
+func TestParseITT_Languages(t *testing.T) {
+	const source = `<tt xmlns="http://www.w3.org/ns/ttml" ttp:frameRate="24" xml:lang="EN-us">
+  <body>
+    <div>
+      <p begin="00:00:01:00" end="00:00:02:00">Hello</p>
+      <p begin="00:00:02:00" end="00:00:03:00" xml:lang="ar">مرحبا</p>
+    </div>
+    <div xml:lang="fr_fr">
+      <p begin="00:00:03:00" end="00:00:04:00">Bonjour <span xml:lang="DE">Hallo</span></p>
+      <p begin="00:00:04:00" end="00:00:05:00" xml:lang="en-US">Hello</p>
+    </div>
+  </body>
+</tt>`
+	doc, err := ParseITT(source)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if doc.Lang != "en-US" {
+		t.Errorf("Expected document language en-US, got %q", doc.Lang)
+	}
+	wantLangs := []string{"", "ar", "fr-FR", ""}
+	wantDirections := []string{"ltr", "rtl", "ltr", "ltr"}
+	for i, cue := range doc.Cues {
+		if cue.Lang != wantLangs[i] {
+			t.Errorf("Cue %d: expected language %q, got %q", i, wantLangs[i], cue.Lang)
+		}
+		if got := doc.Direction(cue); got != wantDirections[i] {
+			t.Errorf("Cue %d: expected direction %s, got %s", i, wantDirections[i], got)
+		}
+	}
+	if want := `Bonjour <span xml:lang="de">Hallo</span>`; doc.Cues[2].Content != want {
+		t.Errorf("Expected content %q, got %q", want, doc.Cues[2].Content)
+	}
+
+	invalid := strings.Replace(source, `xml:lang="DE"`, `xml:lang="de/DE"`, 1)
+	invalid = strings.Replace(invalid, `xml:lang="ar"`, `xml:lang="arabic language"`, 1)
+	doc, err = ParseITT(invalid)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if len(doc.Diagnostics) != 2 || doc.Diagnostics[0].Action != "kept language" {
+		t.Errorf("Expected two kept language diagnostics, got %v", doc.Diagnostics)
+	}
+	if doc.Cues[1].Lang != "arabic language" {
+		t.Errorf("Expected the invalid language to be kept, got %q", doc.Cues[1].Lang)
+	}
+	if want := `Bonjour <span xml:lang="de/DE">Hallo</span>`; doc.Cues[2].Content != want {
+		t.Errorf("Expected content %q, got %q", want, doc.Cues[2].Content)
+	}
+
+	_, err = ParseITTWithOptions(invalid, Options{CollectErrors: true})
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, errs.ErrInvalidLanguage) {
+		t.Fatalf("Expected a *ParseError with ErrInvalidLanguage, got %v", err)
+	}
+	if pe.Line != 5 || pe.Element != "p" || pe.Attr != "lang" {
+		t.Errorf("Unexpected error location: %+v", pe)
+	}
+}
+
+func TestParseITT_Metadata(t *testing.T) {
+	doc, err := ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttm="http://www.w3.org/ns/ttml#metadata" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:ebuttm="urn:ebu:tt:metadata" ttp:frameRate="24" xml:lang="en">
+  <head>
+    <metadata ttm:role="caption">
+      <ttm:title>Pilot &amp; Friends</ttm:title>
+      <ttm:desc>Episode 1</ttm:desc>
+      <ttm:copyright>2024 Example Studios</ttm:copyright>
+      <ttm:agent xml:id="alice" type="character">
+        <ttm:name type="alias">Alice</ttm:name>
+        <ttm:actor agent="jane"/>
+      </ttm:agent>
+      <ttm:agent xml:id="jane" type="person">
+        <ttm:name type="full">Jane Doe</ttm:name>
+      </ttm:agent>
+      <ebuttm:documentMetadata><ebuttm:documentEbuttVersion>v1.0</ebuttm:documentEbuttVersion><ebuttm:x a="1 &lt; 2"/></ebuttm:documentMetadata>
+    </metadata>
+    <styling/>
+  </head>
+  <body><div><p begin="00:00:01:00" end="00:00:02:00">Hi</p></div></body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	want := Metadata{
+		Title:     "Pilot & Friends",
+		Desc:      "Episode 1",
+		Copyright: "2024 Example Studios",
+		Role:      "caption",
+		Agents: []Agent{
+			{ID: "alice", Type: "character", Names: []AgentName{{Type: "alias", Name: "Alice"}}, Actor: "jane"},
+			{ID: "jane", Type: "person", Names: []AgentName{{Type: "full", Name: "Jane Doe"}}},
+		},
+		Other: []string{
+			`<ebuttm:documentMetadata><ebuttm:documentEbuttVersion>v1.0</ebuttm:documentEbuttVersion><ebuttm:x a="1 &lt; 2"/></ebuttm:documentMetadata>`,
+		},
+		Namespaces: map[string]string{"ebuttm": "urn:ebu:tt:metadata"},
+	}
+	if diff := cmp.Diff(want, doc.Metadata); diff != "" {
+		t.Errorf("Metadata mismatch (-want +got):\n%s", diff)
+	}
+	if len(doc.Cues) != 1 || doc.Cues[0].Content != "Hi" {
+		t.Errorf("Expected the cue to be unaffected, got %+v", doc.Cues)
+	}
+}
+
+func TestParseITT_Speakers(t *testing.T) {
+	doc, err := ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttm="http://www.w3.org/ns/ttml#metadata" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="24" xml:lang="en">
+  <head>
+    <metadata>
+      <ttm:agent xml:id="alice" type="character"><ttm:name type="alias">Alice</ttm:name></ttm:agent>
+    </metadata>
+  </head>
+  <body><div>
+    <p begin="00:00:01:00" end="00:00:02:00" ttm:agent="alice bob" ttm:role="dialog">Hi</p>
+    <p begin="00:00:03:00" end="00:00:04:00"><span ttm:agent="bob" ttm:role="sound">[door]</span></p>
+  </div></body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	if len(doc.Cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %d", len(doc.Cues))
+	}
+	if diff := cmp.Diff([]string{"alice", "bob"}, doc.Cues[0].Agents); diff != "" {
+		t.Errorf("Agents mismatch (-want +got):\n%s", diff)
+	}
+	if doc.Cues[0].Role != "dialog" {
+		t.Errorf("Expected role dialog, got %q", doc.Cues[0].Role)
+	}
+	if want := `<span ttm:agent="bob" ttm:role="sound">[door]</span>`; doc.Cues[1].Content != want {
+		t.Errorf("Expected content %q, got %q", want, doc.Cues[1].Content)
+	}
+	if got := doc.Metadata.AgentName("alice"); got != "Alice" {
+		t.Errorf("Expected the name of alice to be Alice, got %q", got)
+	}
+	if got := doc.Metadata.AgentName("bob"); got != "bob" {
+		t.Errorf("Expected an undefined agent to be named by its ID, got %q", got)
+	}
+	if !doc.HasSpeakers {
+		t.Error("Expected HasSpeakers to be set")
+	}
+}
@@ -4,29 +4,81 @@ import (
 	"math/big"
 
 	"github.com/mediafellows/ittconv/internal/timecode"
+	"github.com/mediafellows/ittconv/internal/units"
 )
 
 // ITTDocument represents the root of an iTunes Timed Text file.
 type ITTDocument struct {
-	Lang                   string
+	Lang                   string // xml:lang of the root element, normalized if it is valid BCP 47
 	TimeBase               string
 	FrameRate              string
 	FrameRateMultiplierNum int
 	FrameRateMultiplierDen int
 	FrameRateValue         *timecode.FrameRate
+	Extent                 string     // tts:extent of the root element
+	CellResolution         string     // ttp:cellResolution
+	PixelAspectRatio       string     // ttp:pixelAspectRatio
+	Units                  units.Root // Parsed root parameters for unit conversion
+	Metadata               Metadata   // <metadata> of the head
+	HasSpeakers            bool       // ttm:agent or ttm:role is set on a <p> or inside one
 	Styles                 map[string]Style
 	Regions                map[string]Region
 	Cues                   []Cue
+	Diagnostics            []Diagnostic // Problems repaired or tolerated during parsing
+}
+
+// Metadata holds the document metadata found in the head, in <metadata>
+// elements or directly.
+type Metadata struct {
+	Title     string  // ttm:title
+	Desc      string  // ttm:desc
+	Copyright string  // ttm:copyright
+	Agents    []Agent // ttm:agent definitions
+	Agent     string  // ttm:agent attribute of the <metadata> element
+	Role      string  // ttm:role attribute of the <metadata> element
+	// Other holds the other metadata elements as raw XML, such as those in
+	// namespaces of other standards.
+	Other []string
+	// Namespaces maps the prefixes declared on the root element, other than
+	// the TTML ones, to their namespace, for use by Other.
+	Namespaces map[string]string
+}
+
+// IsZero reports whether m holds no metadata.
+func (m Metadata) IsZero() bool {
+	return m.Title == "" && m.Desc == "" && m.Copyright == "" && len(m.Agents) == 0 &&
+		m.Agent == "" && m.Role == "" && len(m.Other) == 0
+}
+
+// Agent is a ttm:agent definition: a person, character, group or
+// organization that appears in or contributes to the content.
+type Agent struct {
+	ID    string
+	Type  string      // person, character, group, organization or other
+	Names []AgentName // ttm:name children
+	Actor string      // ttm:actor: the agent that plays a character
+}
+
+// AgentName is a ttm:name of an agent.
+type AgentName struct {
+	Type string // full, family, given, alias or other
+	Name string
 }
 
 // Style represents a TTML style definition.
 type Style struct {
-	ID         string
-	FontFamily string
-	FontSize   string
-	FontWeight string
-	FontStyle  string
-	Color      string
+	ID              string
+	FontFamily      string
+	FontSize        string
+	FontWeight      string
+	FontStyle       string
+	Color           string
+	BackgroundColor string
+	TextDecoration  string
+	Ruby            string // tts:ruby: container, base, text or delimiter
+	TextCombine     string // tts:textCombine, e.g. "all" for tate-chu-yoko
+	Direction       string // tts:direction: ltr or rtl
+	UnicodeBidi     string // tts:unicodeBidi: normal, embed, bidiOverride or isolate
 	// Add other styling attributes as needed
 }
 
@@ -37,6 +89,8 @@ type Region struct {
 	Extent       string
 	TextAlign    string
 	DisplayAlign string
+	WritingMode  string // tts:writingMode, e.g. "tbrl" for vertical text
+	Direction    string // tts:direction: ltr or rtl
 }
 
 // Cue represents a single subtitle entry.
@@ -50,4 +104,47 @@ type Cue struct {
 	RegionID      string
 	StyleIDs      []string
 	Content       string
+	Direction     string   // tts:direction of the <p>, set inline or through its styles
+	Lang          string   // xml:lang of the <p> or an enclosing <div>, if it differs from the document's
+	Agents        []string // ttm:agent of the <p>: the IDs of the agents speaking
+	Role          string   // ttm:role of the <p>, such as "dialog" or "sound"
+	Pos           Position // Location of the <p> start tag in the source
+}
+
+// ZeroMissingTimes sets a missing begin or end of each cue to zero, which is
+// how the writers treat a <p> without timing, so that code comparing cue
+// times can rely on both being set.
+func ZeroMissingTimes(cues []Cue) {
+	for i := range cues {
+		if cues[i].Begin == nil {
+			cues[i].Begin = new(big.Rat)
+		}
+		if cues[i].End == nil {
+			cues[i].End = new(big.Rat)
+		}
+	}
+}
+
+// Name identifies the cue in a message: by its ID, or else by its begin time.
+func (c Cue) Name() string {
+	if c.ID != "" {
+		return "cue " + c.ID
+	}
+	return "the cue at " + FormatMs(c.Begin) + " ms"
+}
+
+// FormatMs formats a time in milliseconds, rounded to whole milliseconds. A
+// missing time is zero.
+func FormatMs(ms *big.Rat) string {
+	if ms == nil {
+		return "0"
+	}
+	return ms.FloatString(0)
+}
+
+// Position identifies a location in the ITT source.
+type Position struct {
+	Offset int // Byte offset from the start of the source
+	Line   int // 1-based line number
+	Column int // 1-based column, counted in characters
 }
@@ -0,0 +1,209 @@
+// Package qc checks the timing and layout of parsed subtitles against the
+// delivery rules of a client profile: reading speed, line length, line count,
+// cue duration, the gap between consecutive cues and overlapping cues.
+package qc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/transform"
+)
+
+// Rule names reported in Issue.Rule.
+const (
+	RuleReadingSpeed = "reading-speed"
+	RuleLineLength   = "line-length"
+	RuleLineCount    = "line-count"
+	RuleMinDuration  = "min-duration"
+	RuleMinGap       = "min-gap"
+	RuleOverlap      = "overlap"
+)
+
+// Profile holds the thresholds of a client's delivery rules. A zero
+// threshold disables the corresponding rule.
+type Profile struct {
+	Name            string
+	MaxCPS          float64       // maximum characters per second
+	MaxCharsPerLine int           // maximum characters on a single line
+	MaxLines        int           // maximum lines per cue
+	MinDuration     time.Duration // minimum cue duration
+	MinGapFrames    int           // minimum gap between consecutive cues, in frames
+	AllowOverlap    bool          // whether cues may overlap in time
+}
+
+// Netflix returns a profile modelled on the Netflix timed text style guide
+// for adult programs.
+func Netflix() Profile {
+	return Profile{
+		Name:            "netflix",
+		MaxCPS:          20,
+		MaxCharsPerLine: 42,
+		MaxLines:        2,
+		MinDuration:     5 * time.Second / 6,
+		MinGapFrames:    2,
+	}
+}
+
+// BBC returns a profile modelled on the BBC subtitle guidelines.
+func BBC() Profile {
+	return Profile{
+		Name:            "bbc",
+		MaxCPS:          17,
+		MaxCharsPerLine: 37,
+		MaxLines:        2,
+		MinDuration:     time.Second,
+		MinGapFrames:    1,
+	}
+}
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (Profile, error) {
+	switch name {
+	case "netflix":
+		return Netflix(), nil
+	case "bbc":
+		return BBC(), nil
+	}
+	return Profile{}, fmt.Errorf("unknown QC profile %q", name)
+}
+
+// Issue is a single rule violation.
+type Issue struct {
+	Rule    string `json:"rule"`
+	CueID   string `json:"cue,omitempty"`
+	Begin   string `json:"begin"`            // begin of the offending cue in milliseconds
+	Line    int    `json:"line,omitempty"`   // 1-based line of the cue's <p> in the source
+	Column  int    `json:"column,omitempty"` // 1-based column of the cue's <p> in the source
+	Message string `json:"message"`
+}
+
+// String formats the issue as "line:column: cue id [begin ms]: rule: message".
+func (i Issue) String() string {
+	var sb strings.Builder
+	if i.Line > 0 {
+		fmt.Fprintf(&sb, "%d:%d: ", i.Line, i.Column)
+	}
+	sb.WriteString("cue")
+	if i.CueID != "" {
+		sb.WriteString(" " + i.CueID)
+	}
+	fmt.Fprintf(&sb, " [%s ms]: %s: %s", i.Begin, i.Rule, i.Message)
+	return sb.String()
+}
+
+// Report is the result of checking a document against a profile.
+type Report struct {
+	File    string  `json:"file,omitempty"` // path of the checked file, set by the caller
+	Profile string  `json:"profile"`
+	Cues    int     `json:"cues"`
+	Issues  []Issue `json:"issues"`
+}
+
+// WriteText writes the report as one line per issue, each prefixed with
+// "file:" when r.File is set.
+func (r Report) WriteText(w io.Writer) error {
+	prefix := ""
+	if r.File != "" {
+		prefix = r.File + ":"
+	}
+	for _, issue := range r.Issues {
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, issue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes reports as an indented JSON array.
+func WriteJSON(w io.Writer, reports []Report) error {
+	if reports == nil {
+		reports = []Report{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// Check runs the rules of profile over the cues of doc, in order of their
+// begin times. A missing begin or end counts as zero, as in the output. The
+// gap rule needs doc.FrameRateValue and is skipped without it.
+func Check(doc *parser.ITTDocument, profile Profile) Report {
+	report := Report{Profile: profile.Name, Cues: len(doc.Cues), Issues: []Issue{}}
+	cues := make([]parser.Cue, len(doc.Cues))
+	copy(cues, doc.Cues)
+	parser.ZeroMissingTimes(cues)
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].Begin.Cmp(cues[j].Begin) < 0
+	})
+
+	var frame *big.Rat // duration of a frame in milliseconds
+	if doc.FrameRateValue != nil && doc.FrameRateValue.Sign() > 0 {
+		frame = new(big.Rat).Quo(big.NewRat(1000, 1), doc.FrameRateValue.Rat)
+	}
+	minDuration := big.NewRat(profile.MinDuration.Milliseconds(), 1)
+
+	var latest *parser.Cue // the earlier cue that ends last
+	for i := range cues {
+		cue := &cues[i]
+		issue := func(rule, format string, args ...any) {
+			report.Issues = append(report.Issues, Issue{
+				Rule:    rule,
+				CueID:   cue.ID,
+				Begin:   parser.FormatMs(cue.Begin),
+				Line:    cue.Pos.Line,
+				Column:  cue.Pos.Column,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		duration := new(big.Rat).Sub(cue.End, cue.Begin)
+		lines := transform.TextLines(cue.Content)
+		chars := 0
+		for n, line := range lines {
+			length := utf8.RuneCountInString(line)
+			chars += length
+			if profile.MaxCharsPerLine > 0 && length > profile.MaxCharsPerLine {
+				issue(RuleLineLength, "line %d has %d characters, at most %d allowed", n+1, length, profile.MaxCharsPerLine)
+			}
+		}
+		if profile.MaxLines > 0 && len(lines) > profile.MaxLines {
+			issue(RuleLineCount, "cue has %d lines, at most %d allowed", len(lines), profile.MaxLines)
+		}
+		if profile.MaxCPS > 0 && duration.Sign() > 0 {
+			seconds, _ := new(big.Rat).Quo(duration, big.NewRat(1000, 1)).Float64()
+			if cps := float64(chars) / seconds; cps > profile.MaxCPS {
+				issue(RuleReadingSpeed, "reading speed is %.1f characters per second, at most %g allowed", cps, profile.MaxCPS)
+			}
+		}
+		if profile.MinDuration > 0 && duration.Cmp(minDuration) < 0 {
+			issue(RuleMinDuration, "cue lasts %s ms, at least %d ms required", duration.FloatString(0), profile.MinDuration.Milliseconds())
+		}
+
+		if latest != nil {
+			gap := new(big.Rat).Sub(cue.Begin, latest.End)
+			switch {
+			case gap.Sign() < 0:
+				if !profile.AllowOverlap {
+					issue(RuleOverlap, "cue overlaps %s by %s ms", latest.Name(), new(big.Rat).Neg(gap).FloatString(0))
+				}
+			case frame != nil && profile.MinGapFrames > 0:
+				frames := new(big.Rat).Quo(gap, frame)
+				if frames.Cmp(big.NewRat(int64(profile.MinGapFrames), 1)) < 0 {
+					issue(RuleMinGap, "gap after %s is %s frames, at least %d required", latest.Name(), frames.FloatString(1), profile.MinGapFrames)
+				}
+			}
+		}
+		if latest == nil || cue.End.Cmp(latest.End) > 0 {
+			latest = cue
+		}
+	}
+	return report
+}
@@ -0,0 +1,133 @@
+package qc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/timecode"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheck(t *testing.T) {
+	doc := &parser.ITTDocument{
+		FrameRateValue: &timecode.FrameRate{Rat: big.NewRat(25, 1)},
+		Cues: []parser.Cue{
+			{ID: "c1", Begin: big.NewRat(1000, 1), End: big.NewRat(3000, 1), Content: "A short line."},
+			// Starts 40 ms (one frame) after c1 ends.
+			{ID: "c2", Begin: big.NewRat(3040, 1), End: big.NewRat(4000, 1), Content: "This line is much too long to read in under a second."},
+			{ID: "c3", Begin: big.NewRat(3900, 1), End: big.NewRat(4500, 1), Content: "One<br/>Two<br/>Three"},
+			{ID: "c4", Begin: big.NewRat(10000, 1), End: big.NewRat(12000, 1), Content: "  Spaced\n   <span style=\"s1\">out</span> &amp; fine  "},
+		},
+	}
+
+	report := Check(doc, Netflix())
+	var got []string
+	for _, issue := range report.Issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		"cue c2 [3040 ms]: line-length: line 1 has 53 characters, at most 42 allowed",
+		"cue c2 [3040 ms]: reading-speed: reading speed is 55.2 characters per second, at most 20 allowed",
+		"cue c2 [3040 ms]: min-gap: gap after cue c1 is 1.0 frames, at least 2 required",
+		"cue c3 [3900 ms]: line-count: cue has 3 lines, at most 2 allowed",
+		"cue c3 [3900 ms]: min-duration: cue lasts 600 ms, at least 833 ms required",
+		"cue c3 [3900 ms]: overlap: cue overlaps cue c2 by 100 ms",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Check issues mismatch (-want +got):\n%s", diff)
+	}
+	if report.Profile != "netflix" || report.Cues != 4 {
+		t.Errorf("Expected profile netflix with 4 cues, got %s with %d", report.Profile, report.Cues)
+	}
+}
+
+func TestCheck_DisabledRules(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			{ID: "c1", Begin: big.NewRat(0, 1), End: big.NewRat(100, 1), Content: "A line that would break most of the rules at once"},
+			{ID: "c2", Begin: big.NewRat(50, 1), End: big.NewRat(200, 1), Content: "x"},
+		},
+	}
+	if report := Check(doc, Profile{AllowOverlap: true}); len(report.Issues) != 0 {
+		t.Errorf("Expected no issues with all rules disabled, got %v", report.Issues)
+	}
+}
+
+func TestCheck_Untimed(t *testing.T) {
+	doc, err := parser.ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="25" xml:lang="en"><body><div>
+<p>No timing</p>
+<p begin="00:00:01:00" end="00:00:03:00">Timed</p>
+</div></body></tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+	report := Check(doc, Netflix())
+	var got []string
+	for _, issue := range report.Issues {
+		got = append(got, issue.String())
+	}
+	want := []string{"2:1: cue [0 ms]: min-duration: cue lasts 0 ms, at least 833 ms required"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Check issues mismatch (-want +got):\n%s", diff)
+	}
+	if doc.Cues[0].Begin != nil || doc.Cues[0].End != nil {
+		t.Errorf("Expected Check to leave the document unchanged, got %v-%v", doc.Cues[0].Begin, doc.Cues[0].End)
+	}
+}
+
+func TestReport_WriteText(t *testing.T) {
+	report := Check(&parser.ITTDocument{Cues: []parser.Cue{{ID: "c1", Begin: big.NewRat(0, 1), End: big.NewRat(100, 1), Content: "Hi"}}}, BBC())
+	report.File = "in.itt"
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := "in.itt:cue c1 [0 ms]: reading-speed: reading speed is 20.0 characters per second, at most 17 allowed\n" +
+		"in.itt:cue c1 [0 ms]: min-duration: cue lasts 100 ms, at least 1000 ms required\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteText mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	report := Check(&parser.ITTDocument{Cues: []parser.Cue{{ID: "c1", Begin: big.NewRat(0, 1), End: big.NewRat(100, 1), Content: "Hi"}}}, BBC())
+	report.File = "in.itt"
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, []Report{report}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded []Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got %v:\n%s", err, buf.String())
+	}
+	if diff := cmp.Diff([]Report{report}, decoded); diff != "" {
+		t.Errorf("JSON round trip mismatch (-want +got):\n%s", diff)
+	}
+	for _, field := range []string{`"file": "in.itt"`, `"rule": "min-duration"`} {
+		if !strings.Contains(buf.String(), field) {
+			t.Errorf("Expected %s in the JSON report, got:\n%s", field, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, nil); err != nil || buf.String() != "[]\n" {
+		t.Errorf("Expected an empty array for no reports, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range []string{"netflix", "bbc"} {
+		p, err := LookupProfile(name)
+		if err != nil || p.Name != name {
+			t.Errorf("LookupProfile(%q) = %v, %v", name, p.Name, err)
+		}
+	}
+	if _, err := LookupProfile("acme"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"math/big"
 	"strconv"
 	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
 )
 
 // FrameRate represents a video frame rate as a rational number for precision.
@@ -26,11 +28,11 @@ func NewFrameRate(s string) (*FrameRate, error) {
 
 		num, ok := new(big.Int).SetString(numStr, 10)
 		if !ok {
-			return nil, fmt.Errorf("invalid number format in framerate: %s", numStr)
+			return nil, errs.New(errs.ErrInvalidFrameRate, "invalid number format in framerate: %s", numStr)
 		}
 		den, ok := new(big.Int).SetString(denStr, 10)
 		if !ok {
-			return nil, fmt.Errorf("invalid number format in framerate: %s", denStr)
+			return nil, errs.New(errs.ErrInvalidFrameRate, "invalid number format in framerate: %s", denStr)
 		}
 		r.SetFrac(num, den)
 
@@ -38,7 +40,7 @@ func NewFrameRate(s string) (*FrameRate, error) {
 		// Handle integer frame rates
 		_, ok := r.SetString(s)
 		if !ok {
-			return nil, fmt.Errorf("invalid framerate format: %s", s)
+			return nil, errs.New(errs.ErrInvalidFrameRate, "invalid framerate format: %s", s)
 		}
 	}
 	return &FrameRate{r}, nil
@@ -68,28 +70,28 @@ func ParseSMPTETimecode(s string) (*SMPTETimecode, error) {
 
 	parts := strings.Split(normalized, ":")
 	if len(parts) != 4 {
-		return nil, fmt.Errorf("invalid SMPTE timecode format: %s, expected HH:MM:SS:FF", s)
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid SMPTE timecode format: %s, expected HH:MM:SS:FF", s)
 	}
 
 	h, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return nil, fmt.Errorf("invalid hours in timecode %s: %w", s, err)
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid hours in timecode %s: %w", s, err)
 	}
 	m, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return nil, fmt.Errorf("invalid minutes in timecode %s: %w", s, err)
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid minutes in timecode %s: %w", s, err)
 	}
 	s2, err := strconv.Atoi(parts[2])
 	if err != nil {
-		return nil, fmt.Errorf("invalid seconds in timecode %s: %w", s, err)
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid seconds in timecode %s: %w", s, err)
 	}
 	f, err := strconv.Atoi(parts[3])
 	if err != nil {
-		return nil, fmt.Errorf("invalid frames in timecode %s: %w", s, err)
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid frames in timecode %s: %w", s, err)
 	}
 
 	if m < 0 || m >= 60 || s2 < 0 || s2 >= 60 || f < 0 {
-		return nil, fmt.Errorf("timecode out of range: %s", s)
+		return nil, errs.New(errs.ErrInvalidTimecode, "timecode out of range: %s", s)
 	}
 
 	return &SMPTETimecode{
@@ -104,7 +106,7 @@ func ParseSMPTETimecode(s string) (*SMPTETimecode, error) {
 // ToMilliseconds converts SMPTETimecode to milliseconds using the given FrameRate.
 func (t *SMPTETimecode) ToMilliseconds(fr *FrameRate) (*big.Rat, error) {
 	if fr == nil || fr.Num().Cmp(big.NewInt(0)) == 0 {
-		return nil, fmt.Errorf("invalid framerate: cannot be nil or zero")
+		return nil, errs.New(errs.ErrInvalidFrameRate, "invalid framerate: cannot be nil or zero")
 	}
 
 	// Total seconds from HH:MM:SS
@@ -130,8 +132,11 @@ func (t *SMPTETimecode) ToMilliseconds(fr *FrameRate) (*big.Rat, error) {
 
 // MillisecondsToSMPTETimecode converts milliseconds to SMPTETimecode using the given FrameRate.
 func MillisecondsToSMPTETimecode(ms *big.Rat, fr *FrameRate) (*SMPTETimecode, error) {
-	if ms == nil || fr == nil || fr.Num().Cmp(big.NewInt(0)) == 0 {
-		return nil, fmt.Errorf("invalid input: milliseconds or framerate cannot be nil or zero")
+	if fr == nil || fr.Num().Cmp(big.NewInt(0)) == 0 {
+		return nil, errs.New(errs.ErrInvalidFrameRate, "invalid framerate: cannot be nil or zero")
+	}
+	if ms == nil {
+		return nil, errs.New(errs.ErrInvalidTimecode, "invalid input: milliseconds cannot be nil")
 	}
 
 	sign := 1
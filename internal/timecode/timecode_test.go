@@ -1,8 +1,11 @@
 package timecode
 
 import (
+	"errors"
 	"math/big"
 	"testing"
+
+	"github.com/mediafellows/ittconv/internal/errs"
 )
 
 func tc(h, m, s, f int) *SMPTETimecode {
@@ -76,6 +79,8 @@ func TestParseSMPTETimecode(t *testing.T) {
 			if tt.expectErr {
 				if err == nil {
 					t.Errorf("Expected error for input %s, but got none", tt.input)
+				} else if !errors.Is(err, errs.ErrInvalidTimecode) {
+					t.Errorf("Expected ErrInvalidTimecode for input %s, got: %v", tt.input, err)
 				}
 			} else {
 				if err != nil {
@@ -223,3 +228,15 @@ func TestToClockTime(t *testing.T) {
 		})
 	}
 }
+
+func TestNilFrameRateCategory(t *testing.T) {
+	if _, err := tc(0, 0, 1, 0).ToMilliseconds(nil); !errors.Is(err, errs.ErrInvalidFrameRate) {
+		t.Errorf("ToMilliseconds: expected ErrInvalidFrameRate, got %v", err)
+	}
+	if _, err := MillisecondsToSMPTETimecode(big.NewRat(1000, 1), nil); !errors.Is(err, errs.ErrInvalidFrameRate) {
+		t.Errorf("MillisecondsToSMPTETimecode: expected ErrInvalidFrameRate, got %v", err)
+	}
+	if _, err := MillisecondsToSMPTETimecode(nil, &FrameRate{big.NewRat(24, 1)}); !errors.Is(err, errs.ErrInvalidTimecode) {
+		t.Errorf("MillisecondsToSMPTETimecode: expected ErrInvalidTimecode for nil milliseconds, got %v", err)
+	}
+}
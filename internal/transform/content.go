@@ -0,0 +1,167 @@
+package transform
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cue content is the inner markup of a <p>. The transforms treat it as a
+// sequence of top-level segments: runs of text, elements such as styled
+// spans that are kept whole, and <br/> line breaks.
+type segment struct {
+	raw  string // markup of the segment, empty for line breaks
+	br   bool   // a <br/> line break
+	elem bool   // an element other than <br/>, kept whole
+}
+
+var (
+	// brRe matches a <br/> tag, with or without a prefix and attributes.
+	brRe = regexp.MustCompile(`^<(?:[\w-]+:)?br\b[^>]*>`)
+	// spaceRefRe matches character references to whitespace, which the
+	// parser writes for newlines in the source.
+	spaceRefRe = regexp.MustCompile(`&#(?:x0*(?:9|[aA]|[dD]|20)|0*(?:9|10|13|32));`)
+)
+
+// text returns a text segment, with whitespace character references
+// replaced by the characters they stand for.
+func text(raw string) segment {
+	return segment{raw: spaceRefRe.ReplaceAllStringFunc(raw, func(ref string) string {
+		var r rune
+		if strings.HasPrefix(ref, "&#x") {
+			fmt.Sscanf(ref, "&#x%x;", &r)
+		} else {
+			fmt.Sscanf(ref, "&#%d;", &r)
+		}
+		return string(r)
+	})}
+}
+
+// parseContent splits content into top-level segments.
+func parseContent(content string) []segment {
+	var segs []segment
+	for len(content) > 0 {
+		lt := strings.IndexByte(content, '<')
+		switch {
+		case lt < 0:
+			segs = append(segs, text(content))
+			return segs
+		case lt > 0:
+			segs = append(segs, text(content[:lt]))
+			content = content[lt:]
+			continue
+		}
+		if m := brRe.FindString(content); m != "" {
+			segs = append(segs, segment{br: true})
+			content = content[len(m):]
+			// A <br></br> pair counts as one break.
+			if rest := strings.TrimPrefix(content, "</br>"); rest != content {
+				content = rest
+			}
+			continue
+		}
+		n := elementLength(content)
+		segs = append(segs, segment{raw: content[:n], elem: true})
+		content = content[n:]
+	}
+	return segs
+}
+
+// elementLength returns the length of the element, comment or other markup
+// at the start of s, including any nested elements and its end tag.
+func elementLength(s string) int {
+	depth := 0
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			i++
+			continue
+		}
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			return len(s)
+		}
+		tag := s[i : i+end+1]
+		i += end + 1
+		switch {
+		case strings.HasPrefix(tag, "</"):
+			depth--
+		case strings.HasSuffix(tag, "/>"), strings.HasPrefix(tag, "<!"), strings.HasPrefix(tag, "<?"):
+		default:
+			depth++
+		}
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// joinContent is the inverse of parseContent.
+func joinContent(segs []segment) string {
+	var sb strings.Builder
+	for _, s := range segs {
+		if s.br {
+			sb.WriteString("<br/>")
+		} else {
+			sb.WriteString(s.raw)
+		}
+	}
+	return sb.String()
+}
+
+// trimContent removes the whitespace around content, including whitespace
+// written as character references.
+func trimContent(content string) string {
+	return strings.TrimSpace(joinContent(parseContent(content)))
+}
+
+// visibleText returns the text of markup as displayed: tags removed,
+// entities resolved and runs of whitespace collapsed to a single space.
+func visibleText(markup string) string {
+	var sb strings.Builder
+	walkText(markup, func(cd []byte) { sb.Write(cd) }, nil)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// TextLines returns the displayed lines of cue content: the text of each
+// line as visibleText returns it, with a <br/> at any depth starting a new
+// line.
+func TextLines(content string) []string {
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		lines = append(lines, strings.Join(strings.Fields(line.String()), " "))
+		line.Reset()
+	}
+	walkText(content, func(cd []byte) { line.Write(cd) }, flush)
+	flush()
+	return lines
+}
+
+// walkText calls text for each run of character data in markup, with
+// entities resolved, and br, if not nil, for each <br/> element.
+func walkText(markup string, text func([]byte), br func()) {
+	dec := xml.NewDecoder(strings.NewReader("<p>" + markup + "</p>"))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text(t)
+		case xml.StartElement:
+			if br != nil && t.Name.Local == "br" {
+				br()
+			}
+		}
+	}
+}
+
+// visibleLen returns the number of characters visibleText displays.
+func visibleLen(markup string) int {
+	return utf8.RuneCountInString(visibleText(markup))
+}
@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// GapOptions configures EnforceGaps. Both values count frames at the frame
+// rate of the document.
+type GapOptions struct {
+	// MinGapFrames is the minimum gap between consecutive cues. Shorter gaps
+	// are widened by moving the end of the earlier cue.
+	MinGapFrames int
+	// ChainFrames chains cues: gaps shorter than this are closed down to
+	// MinGapFrames by extending the earlier cue.
+	ChainFrames int
+}
+
+// EnforceGaps adjusts the end of each cue so that the gap to the next cue is
+// either at least opts.ChainFrames, or exactly opts.MinGapFrames. Cues are
+// sorted by begin time first; overlapping cues are left alone, as is a cue
+// that would be trimmed to nothing. It needs doc.FrameRateValue.
+func EnforceGaps(doc *parser.ITTDocument, opts GapOptions) ([]parser.Diagnostic, error) {
+	if opts.MinGapFrames <= 0 && opts.ChainFrames <= 0 {
+		return nil, nil
+	}
+	if doc.FrameRateValue == nil || doc.FrameRateValue.Sign() <= 0 {
+		return nil, errs.New(errs.ErrMissingFrameRate, "enforcing gaps between cues requires a frame rate")
+	}
+	frame := new(big.Rat).Quo(big.NewRat(1000, 1), doc.FrameRateValue.Rat)
+	minGap := new(big.Rat).Mul(frame, big.NewRat(int64(opts.MinGapFrames), 1))
+	threshold := minGap
+	if opts.ChainFrames > opts.MinGapFrames {
+		threshold = new(big.Rat).Mul(frame, big.NewRat(int64(opts.ChainFrames), 1))
+	}
+
+	sortCues(doc.Cues)
+	var diags []parser.Diagnostic
+	for i := 0; i+1 < len(doc.Cues); i++ {
+		cue, next := &doc.Cues[i], &doc.Cues[i+1]
+		gap := new(big.Rat).Sub(next.Begin, cue.End)
+		if gap.Sign() < 0 || gap.Cmp(threshold) >= 0 || gap.Cmp(minGap) == 0 {
+			continue
+		}
+		frames := formatFrames(new(big.Rat).Quo(gap, frame))
+		end := new(big.Rat).Sub(next.Begin, minGap)
+		if end.Cmp(cue.Begin) <= 0 {
+			diags = append(diags, diagnose(doc, cue, "kept gap", "gap before %s is %s frames, but %s is too short to trim", next.Name(), frames, cue.Name()))
+			continue
+		}
+		action := "trimmed"
+		if end.Cmp(cue.End) > 0 {
+			action = "extended"
+		}
+		diags = append(diags, diagnose(doc, cue, fmt.Sprintf("%s end to %s ms", action, parser.FormatMs(end)), "gap before %s is %s frames", next.Name(), frames))
+		cue.End = end
+	}
+	return diags, nil
+}
+
+// formatFrames formats a frame count, with two decimals if it is fractional.
+func formatFrames(frames *big.Rat) string {
+	if frames.IsInt() {
+		return frames.RatString()
+	}
+	return frames.FloatString(2)
+}
@@ -0,0 +1,249 @@
+package transform
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// NormalizeRule is a set of text clean-ups applied by NormalizeText. Rules
+// combine with |.
+type NormalizeRule uint
+
+const (
+	// NormalizeIndent replaces the newlines and indentation that
+	// pretty-printed XML leaves in cue text with single spaces, and trims
+	// the whitespace around the text.
+	NormalizeIndent NormalizeRule = 1 << iota
+	// NormalizeSpaces collapses runs of spaces and tabs into one space.
+	NormalizeSpaces
+	// NormalizeBreaks removes whitespace before and after <br/>.
+	NormalizeBreaks
+	// NormalizeCurlyQuotes turns straight quotes into typographic ones.
+	NormalizeCurlyQuotes
+	// NormalizeStraightQuotes turns typographic quotes into straight ones.
+	NormalizeStraightQuotes
+	// NormalizeEllipsis turns three dots into an ellipsis character.
+	NormalizeEllipsis
+	// NormalizeDashes writes dialogue dashes at the start of a line as a
+	// hyphen followed by one space. Only a dash before a letter, a quote or
+	// a styled span counts, so negative numbers are left alone.
+	NormalizeDashes
+)
+
+// DefaultNormalizeRules are the whitespace clean-ups, which never change how
+// a cue reads.
+const DefaultNormalizeRules = NormalizeIndent | NormalizeSpaces | NormalizeBreaks
+
+var normalizeRuleNames = []struct {
+	rule NormalizeRule
+	name string
+}{
+	{NormalizeIndent, "indent"},
+	{NormalizeSpaces, "spaces"},
+	{NormalizeBreaks, "breaks"},
+	{NormalizeCurlyQuotes, "curly-quotes"},
+	{NormalizeStraightQuotes, "straight-quotes"},
+	{NormalizeEllipsis, "ellipsis"},
+	{NormalizeDashes, "dashes"},
+}
+
+// String returns the names of the rules in r, separated by commas.
+func (r NormalizeRule) String() string {
+	var names []string
+	for _, n := range normalizeRuleNames {
+		if r&n.rule != 0 {
+			names = append(names, n.name)
+			r &^= n.rule
+		}
+	}
+	if r != 0 {
+		names = append(names, fmt.Sprintf("NormalizeRule(%d)", uint(r)))
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseNormalizeRules returns the set of rules named in names, e.g.
+// "spaces" or "curly-quotes".
+func ParseNormalizeRules(names []string) (NormalizeRule, error) {
+	var rules NormalizeRule
+	for _, name := range names {
+		found := false
+		for _, n := range normalizeRuleNames {
+			if n.name == name {
+				rules |= n.rule
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown normalization rule %q", name)
+		}
+	}
+	return rules, nil
+}
+
+var (
+	indentRe   = regexp.MustCompile(`[ \t\r]*\n\s*`)
+	spacesRe   = regexp.MustCompile(`[ \t]{2,}`)
+	ellipsisRe = regexp.MustCompile(`\.\.\.`)
+	dashRe     = regexp.MustCompile(`^(\s*)[-‐‑–—]\s*`)
+	// dialogueDashRe matches a dash before a letter or an opening quote.
+	dialogueDashRe = regexp.MustCompile(`^(\s*)[-‐‑–—]\s*([\p{L}"'“‘„«¿¡])`)
+	escaper        = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	straightRep    = strings.NewReplacer("“", `"`, "”", `"`, "„", `"`, "‘", "'", "’", "'", "‚", "'")
+)
+
+// NormalizeText applies rules to the text of every cue and records each cue
+// it changes as a diagnostic, naming the rules that changed it.
+func NormalizeText(doc *parser.ITTDocument, rules NormalizeRule) []parser.Diagnostic {
+	if rules == 0 {
+		return nil
+	}
+	var diags []parser.Diagnostic
+	for i := range doc.Cues {
+		cue := &doc.Cues[i]
+		content, applied := normalizeRules(cue.Content, rules)
+		if applied == 0 {
+			continue
+		}
+		cue.Content = content
+		diags = append(diags, diagnose(doc, cue, "normalized", "%s has text to clean up (%s)", cue.Name(), applied))
+	}
+	return diags
+}
+
+// normalize applies rules to cue content.
+func normalize(content string, rules NormalizeRule) string {
+	content, _ = normalizeRules(content, rules)
+	return content
+}
+
+// normalizeRules applies rules to cue content and returns the result along
+// with the rules that changed it. Straight quotes win over curly quotes.
+func normalizeRules(content string, rules NormalizeRule) (string, NormalizeRule) {
+	if rules&NormalizeStraightQuotes != 0 {
+		rules &^= NormalizeCurlyQuotes
+	}
+	var applied NormalizeRule
+	for _, n := range normalizeRuleNames {
+		if rules&n.rule == 0 {
+			continue
+		}
+		if out := applyRule(content, n.rule); out != content {
+			content = out
+			applied |= n.rule
+		}
+	}
+	return content, applied
+}
+
+// applyRule applies a single rule to cue content.
+func applyRule(content string, rule NormalizeRule) string {
+	switch rule {
+	case NormalizeIndent:
+		content = mapText(content, func(s string) string {
+			return indentRe.ReplaceAllString(s, " ")
+		})
+		return trimContent(content)
+	case NormalizeSpaces:
+		return mapText(content, func(s string) string {
+			return spacesRe.ReplaceAllString(s, " ")
+		})
+	case NormalizeBreaks:
+		segs := parseContent(content)
+		for i := range segs {
+			if segs[i].br || segs[i].elem {
+				continue
+			}
+			if i > 0 && segs[i-1].br {
+				segs[i].raw = strings.TrimLeftFunc(segs[i].raw, unicode.IsSpace)
+			}
+			if i+1 < len(segs) && segs[i+1].br {
+				segs[i].raw = strings.TrimRightFunc(segs[i].raw, unicode.IsSpace)
+			}
+		}
+		return joinContent(segs)
+	case NormalizeStraightQuotes:
+		return mapText(content, straightRep.Replace)
+	case NormalizeCurlyQuotes:
+		prev := ' '
+		return mapText(content, func(s string) string {
+			out := []rune(s)
+			for i, r := range out {
+				opening := unicode.IsSpace(prev) || strings.ContainsRune("([{“‘—–-", prev)
+				switch {
+				case r == '"' && opening:
+					out[i] = '“'
+				case r == '"':
+					out[i] = '”'
+				case r == '\'' && opening:
+					out[i] = '‘'
+				case r == '\'':
+					out[i] = '’'
+				}
+				prev = r
+			}
+			return string(out)
+		})
+	case NormalizeEllipsis:
+		return mapText(content, func(s string) string {
+			return ellipsisRe.ReplaceAllString(s, "…")
+		})
+	case NormalizeDashes:
+		segs := parseContent(content)
+		for i := range segs {
+			if segs[i].br || segs[i].elem || (i > 0 && !segs[i-1].br) {
+				continue
+			}
+			if i+1 < len(segs) && segs[i+1].elem && isDash(segs[i].raw) {
+				// A dash before a styled span, as in "-<i>Where?</i>".
+				segs[i].raw = dashRe.ReplaceAllString(segs[i].raw, "$1- ")
+				continue
+			}
+			segs[i].raw = dialogueDashRe.ReplaceAllString(segs[i].raw, "$1- $2")
+		}
+		return joinContent(segs)
+	}
+	return content
+}
+
+// isDash reports whether text is only a dialogue dash.
+func isDash(text string) bool {
+	return dashRe.ReplaceAllString(text, "") == ""
+}
+
+// mapText applies f to each run of text in markup, at any depth. Entities
+// are resolved before f sees the text and the result is escaped again. Runs
+// that f leaves unchanged keep their original markup.
+func mapText(markup string, f func(string) string) string {
+	var sb strings.Builder
+	for len(markup) > 0 {
+		if markup[0] == '<' {
+			end := strings.IndexByte(markup, '>')
+			if end < 0 {
+				sb.WriteString(markup)
+				break
+			}
+			sb.WriteString(markup[:end+1])
+			markup = markup[end+1:]
+			continue
+		}
+		end := strings.IndexByte(markup, '<')
+		if end < 0 {
+			end = len(markup)
+		}
+		raw := markup[:end]
+		text := html.UnescapeString(raw)
+		if out := f(text); out != text {
+			sb.WriteString(escaper.Replace(out))
+		} else {
+			sb.WriteString(raw)
+		}
+		markup = markup[end:]
+	}
+	return sb.String()
+}
@@ -0,0 +1,310 @@
+package transform
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/units"
+)
+
+// OverlapStrategy selects how ResolveOverlaps handles cues that overlap in
+// time.
+type OverlapStrategy int
+
+const (
+	// OverlapKeep leaves overlapping cues unchanged.
+	OverlapKeep OverlapStrategy = iota
+	// OverlapTrim ends the earlier cue where the later one begins.
+	OverlapTrim
+	// OverlapMerge splits overlapping cues at every begin and end and shows
+	// the text of all cues active in a span as one multi-line cue.
+	OverlapMerge
+	// OverlapStack moves overlapping cues into regions stacked above the
+	// region of the cue they overlap.
+	OverlapStack
+)
+
+// String returns the name used for the strategy on the command line.
+func (s OverlapStrategy) String() string {
+	switch s {
+	case OverlapKeep:
+		return "keep"
+	case OverlapTrim:
+		return "trim"
+	case OverlapMerge:
+		return "merge"
+	case OverlapStack:
+		return "stack"
+	}
+	return fmt.Sprintf("OverlapStrategy(%d)", int(s))
+}
+
+// ParseOverlapStrategy returns the strategy named s ("keep", "trim", "merge"
+// or "stack").
+func ParseOverlapStrategy(s string) (OverlapStrategy, error) {
+	for _, os := range []OverlapStrategy{OverlapKeep, OverlapTrim, OverlapMerge, OverlapStack} {
+		if os.String() == s {
+			return os, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overlap strategy %q, expected keep, trim, merge or stack", s)
+}
+
+// Overlap is a pair of cues that are displayed at the same time.
+type Overlap struct {
+	First    int      // index of the cue that begins first
+	Second   int      // index of the cue that begins second
+	Duration *big.Rat // length of the overlap in milliseconds
+}
+
+// FindOverlaps returns every pair of overlapping cues, ordered by the begin
+// time of the second cue. Cues that merely touch do not overlap. A missing
+// begin or end is set to zero. The cues are swept once in order of their
+// begin times, keeping the cues still displayed.
+func FindOverlaps(cues []parser.Cue) []Overlap {
+	order := make([]int, len(cues))
+	for i := range order {
+		order[i] = i
+	}
+	sortIndexes(cues, order)
+
+	var overlaps []Overlap
+	var active []int
+	for _, i := range order {
+		// A cue that ends before this one begins ends before every later
+		// cue begins too.
+		active = slices.DeleteFunc(active, func(j int) bool {
+			return cues[j].End.Cmp(cues[i].Begin) <= 0
+		})
+		for _, j := range active {
+			end := cues[i].End
+			if cues[j].End.Cmp(end) < 0 {
+				end = cues[j].End
+			}
+			overlaps = append(overlaps, Overlap{First: j, Second: i, Duration: new(big.Rat).Sub(end, cues[i].Begin)})
+		}
+		active = append(active, i)
+	}
+	return overlaps
+}
+
+// ResolveOverlaps applies strategy to the overlapping cues of doc. Unless the
+// strategy is OverlapKeep, the cues are sorted by begin time first.
+func ResolveOverlaps(doc *parser.ITTDocument, strategy OverlapStrategy) []parser.Diagnostic {
+	if strategy == OverlapKeep {
+		return nil
+	}
+	sortCues(doc.Cues)
+	switch strategy {
+	case OverlapTrim:
+		return trimOverlaps(doc)
+	case OverlapMerge:
+		return mergeOverlaps(doc)
+	case OverlapStack:
+		return stackOverlaps(doc)
+	}
+	return nil
+}
+
+// trimOverlaps ends each cue where the first cue overlapping it begins.
+func trimOverlaps(doc *parser.ITTDocument) []parser.Diagnostic {
+	var diags []parser.Diagnostic
+	for _, o := range FindOverlaps(doc.Cues) {
+		first, second := &doc.Cues[o.First], &doc.Cues[o.Second]
+		if first.End.Cmp(second.Begin) <= 0 {
+			continue // already trimmed for an earlier cue
+		}
+		if first.Begin.Cmp(second.Begin) == 0 {
+			diags = append(diags, diagnose(doc, second, "kept overlap", "%s begins together with %s and cannot be trimmed", second.Name(), first.Name()))
+			continue
+		}
+		diags = append(diags, diagnose(doc, first, fmt.Sprintf("trimmed end to %s ms", parser.FormatMs(second.Begin)), "%s overlaps %s by %s ms", first.Name(), second.Name(), parser.FormatMs(new(big.Rat).Sub(first.End, second.Begin))))
+		first.End = new(big.Rat).Set(second.Begin)
+	}
+	return diags
+}
+
+// mergeOverlaps replaces each group of overlapping cues by one cue per span
+// between consecutive begin and end times, holding the text of every cue
+// active in that span on separate lines.
+func mergeOverlaps(doc *parser.ITTDocument) []parser.Diagnostic {
+	overlaps := FindOverlaps(doc.Cues)
+	if len(overlaps) == 0 {
+		return nil
+	}
+	var diags []parser.Diagnostic
+	for _, o := range overlaps {
+		first, second := &doc.Cues[o.First], &doc.Cues[o.Second]
+		diags = append(diags, diagnose(doc, second, "merged into multi-line cues", "%s overlaps %s by %s ms", second.Name(), first.Name(), parser.FormatMs(o.Duration)))
+	}
+
+	var merged []parser.Cue
+	for start := 0; start < len(doc.Cues); {
+		// Collect the group of cues chained together by overlaps.
+		end := start + 1
+		groupEnd := doc.Cues[start].End
+		for end < len(doc.Cues) && doc.Cues[end].Begin.Cmp(groupEnd) < 0 {
+			if doc.Cues[end].End.Cmp(groupEnd) > 0 {
+				groupEnd = doc.Cues[end].End
+			}
+			end++
+		}
+		cues, dropped := mergeGroup(doc, doc.Cues[start:end])
+		merged = append(merged, cues...)
+		diags = append(diags, dropped...)
+		start = end
+	}
+	doc.Cues = merged
+	return diags
+}
+
+// mergeGroup splits a group of overlapping cues, sorted by begin time, into
+// cues that do not overlap. It sweeps the begin and end times in order,
+// keeping the cues active between them. Cues that last no time at all are
+// dropped.
+func mergeGroup(doc *parser.ITTDocument, group []parser.Cue) ([]parser.Cue, []parser.Diagnostic) {
+	if len(group) == 1 {
+		return group, nil
+	}
+	var diags []parser.Diagnostic
+	group = slices.DeleteFunc(slices.Clone(group), func(cue parser.Cue) bool {
+		if cue.End.Cmp(cue.Begin) > 0 {
+			return false
+		}
+		diags = append(diags, diagnose(doc, &cue, "dropped cue", "%s lasts no time and is hidden by the cues it overlaps", cue.Name()))
+		return true
+	})
+	ends := make([]int, len(group)) // indexes into group ordered by end time
+	for i := range ends {
+		ends[i] = i
+	}
+	sort.SliceStable(ends, func(i, j int) bool {
+		return group[ends[i]].End.Cmp(group[ends[j]].End) < 0
+	})
+
+	var out []parser.Cue
+	var active []int // indexes into group of the cues shown, in group order
+	begun, ended := 0, 0
+	for ended < len(ends) {
+		// from is the next begin or end time, and to the one after it.
+		from := group[ends[ended]].End
+		if begun < len(group) && group[begun].Begin.Cmp(from) < 0 {
+			from = group[begun].Begin
+		}
+		for ended < len(ends) && group[ends[ended]].End.Cmp(from) <= 0 {
+			if k := slices.Index(active, ends[ended]); k >= 0 {
+				active = slices.Delete(active, k, k+1)
+			}
+			ended++
+		}
+		for begun < len(group) && group[begun].Begin.Cmp(from) <= 0 {
+			active = append(active, begun)
+			begun++
+		}
+		if len(active) == 0 || ended == len(ends) {
+			continue
+		}
+		to := group[ends[ended]].End
+		if begun < len(group) && group[begun].Begin.Cmp(to) < 0 {
+			to = group[begun].Begin
+		}
+
+		cue := group[active[0]]
+		cue.Begin = new(big.Rat).Set(from)
+		cue.End = new(big.Rat).Set(to)
+		if len(active) > 1 {
+			// Each cue keeps its own styles on its line.
+			var lines []string
+			for _, k := range active {
+				a := &group[k]
+				if len(a.StyleIDs) > 0 {
+					lines = append(lines, `<span style="`+strings.Join(a.StyleIDs, " ")+`">`+a.Content+`</span>`)
+				} else {
+					lines = append(lines, a.Content)
+				}
+			}
+			cue.Content = strings.Join(lines, "<br/>")
+			cue.StyleIDs = nil
+		}
+		out = append(out, cue)
+	}
+	return out, diags
+}
+
+// stackOverlaps moves each cue that overlaps an earlier one into a region
+// stacked above its own, one region height per level.
+func stackOverlaps(doc *parser.ITTDocument) []parser.Diagnostic {
+	var diags []parser.Diagnostic
+	var levels []*parser.Cue // the cue that ends last on each level
+	for i := range doc.Cues {
+		cue := &doc.Cues[i]
+		level := 0
+		for level < len(levels) && levels[level].End.Cmp(cue.Begin) > 0 {
+			level++
+		}
+		if level == len(levels) {
+			levels = append(levels, cue)
+		}
+		below := levels[0]
+		levels[level] = cue
+		if level == 0 {
+			continue
+		}
+		region := stackedRegion(doc, cue.RegionID, level)
+		diags = append(diags, diagnose(doc, cue, "moved to region "+region, "%s overlaps %s", cue.Name(), below.Name()))
+		cue.RegionID = region
+	}
+	return diags
+}
+
+// Geometry of the region used for stacking cues that have no region of their
+// own, or whose region cannot be converted to percentages.
+var (
+	defaultOrigin = [2]float64{10, 80}
+	defaultExtent = [2]float64{80, 10}
+)
+
+// stackedRegion returns the ID of a copy of region id moved up by level
+// region heights, adding it to doc.Regions if needed.
+func stackedRegion(doc *parser.ITTDocument, id string, level int) string {
+	base, ok := doc.Regions[id]
+	if !ok {
+		base = parser.Region{ID: "stack"}
+	}
+	origin, errOrigin := percentages(doc.Units, base.Origin)
+	extent, errExtent := percentages(doc.Units, base.Extent)
+	if errOrigin != nil || errExtent != nil {
+		origin, extent = defaultOrigin, defaultExtent
+	}
+
+	stacked := base
+	stacked.ID = fmt.Sprintf("%s-stack%d", base.ID, level)
+	if _, exists := doc.Regions[stacked.ID]; exists {
+		return stacked.ID
+	}
+	y := origin[1] - float64(level)*extent[1]
+	if y < 0 {
+		y = 0
+	}
+	stacked.Origin = units.FormatPercentages([2]float64{origin[0], y})
+	stacked.Extent = units.FormatPercentages(extent)
+	if doc.Regions == nil {
+		doc.Regions = map[string]parser.Region{}
+	}
+	doc.Regions[stacked.ID] = stacked
+	return stacked.ID
+}
+
+// percentages converts a pair of lengths such as "10% 80%" to percentages of
+// the root container.
+func percentages(root units.Root, s string) ([2]float64, error) {
+	lengths, err := units.ParseLengths(s)
+	if err != nil {
+		return [2]float64{}, err
+	}
+	return root.Percentages(lengths)
+}
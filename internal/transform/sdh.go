@@ -0,0 +1,319 @@
+package transform
+
+import (
+	"math/big"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// SDHOptions configures StripSDH.
+type SDHOptions struct {
+	// Merge merges a cue into the cue before it when stripping leaves both
+	// with the same text, region and styles and at most MaxGap separates
+	// them.
+	Merge  bool
+	MaxGap time.Duration
+}
+
+var (
+	// musicNotes matches the note characters that mark music and lyrics.
+	musicNotes = regexp.MustCompile(`[♩♪♫♬]`)
+	// speakerLabelRe matches a speaker label in capitals, such as "JOHN:" or
+	// "MAN 2:", after an optional dialogue dash at the start of a line.
+	speakerLabelRe = regexp.MustCompile(`^(\s*(?:[-‐‑–—]\s*)?)\p{Lu}[\p{Lu}\d .'’&-]*:(?:\s+|$)`)
+	// emptySpanRe matches a span left without any text.
+	emptySpanRe = regexp.MustCompile(`<(?:[\w-]+:)?span\b[^>]*>(\s*)</(?:[\w-]+:)?span>`)
+	// startTagRe matches a start or empty-element tag and captures its
+	// attributes.
+	startTagRe = regexp.MustCompile(`^<[\w:-]+((?:\s[^>]*?)?)/?>$`)
+	// soundRoleRe matches a ttm:role attribute and captures its value.
+	soundRoleRe = regexp.MustCompile(`\sttm:role\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// StripSDH removes the parts of cues that only matter to viewers who cannot
+// hear the audio, to derive plain subtitles from subtitles for the deaf and
+// hard of hearing: cues and spans with ttm:role="sound", text in brackets or
+// parentheses, music notes and speaker labels such as "JOHN:". Lines left
+// empty are removed, and a lone dialogue dash left on the only remaining
+// line is dropped. Cues left without text are removed and, with
+// opts.Merge, neighbouring cues left with the same text are merged. Each
+// removed or merged cue is recorded as a diagnostic. A missing begin or end
+// is set to zero.
+func StripSDH(doc *parser.ITTDocument, opts SDHOptions) []parser.Diagnostic {
+	parser.ZeroMissingTimes(doc.Cues)
+	var diags []parser.Diagnostic
+	out := doc.Cues[:0]
+	for _, cue := range doc.Cues {
+		if hasRole(cue.Role, "sound") {
+			diags = append(diags, diagnose(doc, &cue, "removed", "%s is a sound description", cue.Name()))
+			continue
+		}
+		cue.Content = stripSDH(cue.Content)
+		if visibleText(cue.Content) == "" {
+			diags = append(diags, diagnose(doc, &cue, "removed", "%s holds only sound descriptions", cue.Name()))
+			continue
+		}
+		out = append(out, cue)
+	}
+	doc.Cues = out
+	if opts.Merge {
+		diags = append(diags, mergeRepeats(doc, opts.MaxGap)...)
+	}
+	return diags
+}
+
+// stripSDH removes sound descriptions from cue content, returning content
+// without them unchanged.
+func stripSDH(content string) string {
+	stripped := removeSoundSpans(content)
+	stripped = removeBrackets(stripped)
+	stripped = mapText(stripped, func(s string) string {
+		return musicNotes.ReplaceAllString(s, "")
+	})
+	stripped = removeSpeakerLabels(stripped)
+	if stripped == content {
+		return content
+	}
+	for {
+		s := emptySpanRe.ReplaceAllString(stripped, "$1")
+		if s == stripped {
+			break
+		}
+		stripped = s
+	}
+	return tidyLines(stripped, slices.ContainsFunc(parseContent(content), func(s segment) bool { return s.br }))
+}
+
+// removeSoundSpans removes the elements, at any depth, whose ttm:role
+// includes "sound".
+func removeSoundSpans(markup string) string {
+	var sb strings.Builder
+	for len(markup) > 0 {
+		lt := strings.IndexByte(markup, '<')
+		if lt < 0 {
+			sb.WriteString(markup)
+			break
+		}
+		sb.WriteString(markup[:lt])
+		markup = markup[lt:]
+		end := strings.IndexByte(markup, '>')
+		if end < 0 {
+			sb.WriteString(markup)
+			break
+		}
+		tag := markup[:end+1]
+		if m := startTagRe.FindStringSubmatch(tag); m != nil {
+			if r := soundRoleRe.FindStringSubmatch(m[1]); r != nil && hasRole(r[1]+r[2], "sound") {
+				markup = markup[elementLength(markup):]
+				continue
+			}
+		}
+		sb.WriteString(tag)
+		markup = markup[end+1:]
+	}
+	return sb.String()
+}
+
+// hasRole reports whether the ttm:role value roles includes role.
+func hasRole(roles, role string) bool {
+	for _, r := range strings.Fields(roles) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBrackets removes the text in matching brackets and parentheses,
+// along with any line breaks in it. Tags inside are kept, so the markup stays
+// well-formed; spans left empty are removed later. Unmatched brackets are
+// kept.
+func removeBrackets(markup string) string {
+	type opener struct {
+		r  rune
+		at int
+	}
+	var stack []opener
+	var ranges [][2]int
+	for i := 0; i < len(markup); {
+		if markup[i] == '<' {
+			end := strings.IndexByte(markup[i:], '>')
+			if end < 0 {
+				break
+			}
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(markup[i:])
+		switch r {
+		case '[', '(':
+			stack = append(stack, opener{r, i})
+		case ']', ')':
+			open := '['
+			if r == ')' {
+				open = '('
+			}
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].r == open {
+					ranges = append(ranges, [2]int{stack[j].at, i + size})
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+		i += size
+	}
+	if len(ranges) == 0 {
+		return markup
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	var sb strings.Builder
+	last := 0
+	for _, r := range ranges {
+		if r[1] <= last {
+			// Nested in a range already removed.
+			continue
+		}
+		sb.WriteString(markup[last:r[0]])
+		inner := markup[r[0]:r[1]]
+		for len(inner) > 0 {
+			lt := strings.IndexByte(inner, '<')
+			if lt < 0 {
+				break
+			}
+			inner = inner[lt:]
+			end := strings.IndexByte(inner, '>') + 1
+			if tag := inner[:end]; !brRe.MatchString(tag) && tag != "</br>" {
+				sb.WriteString(tag)
+			}
+			inner = inner[end:]
+		}
+		last = r[1]
+	}
+	sb.WriteString(markup[last:])
+	return sb.String()
+}
+
+// removeSpeakerLabels removes speaker labels from the start of each line of
+// markup, keeping any dialogue dash before them.
+func removeSpeakerLabels(markup string) string {
+	var sb strings.Builder
+	lineStart := true
+	for len(markup) > 0 {
+		if markup[0] == '<' {
+			end := strings.IndexByte(markup, '>')
+			if end < 0 {
+				sb.WriteString(markup)
+				break
+			}
+			tag := markup[:end+1]
+			if brRe.MatchString(tag) {
+				lineStart = true
+			}
+			sb.WriteString(tag)
+			markup = markup[end+1:]
+			continue
+		}
+		end := strings.IndexByte(markup, '<')
+		if end < 0 {
+			end = len(markup)
+		}
+		text := markup[:end]
+		if lineStart && strings.TrimSpace(text) != "" {
+			text = speakerLabelRe.ReplaceAllString(text, "$1")
+			lineStart = false
+		}
+		sb.WriteString(text)
+		markup = markup[end:]
+	}
+	return sb.String()
+}
+
+// tidyLines removes the lines of content left without text, or with only a
+// dialogue dash, and the whitespace left around the removed text. If
+// multiline content is left with a single line, its dialogue dash is
+// dropped.
+func tidyLines(content string, multiline bool) string {
+	content = normalize(content, NormalizeSpaces)
+	var lines [][]segment
+	var line []segment
+	for _, s := range parseContent(content) {
+		if s.br {
+			lines = append(lines, line)
+			line = nil
+			continue
+		}
+		line = append(line, s)
+	}
+	lines = append(lines, line)
+
+	var kept [][]segment
+	for _, l := range lines {
+		if t := visibleText(joinContent(l)); t != "" && !isDash(t) {
+			kept = append(kept, l)
+		}
+	}
+	var segs []segment
+	for i, l := range kept {
+		if i > 0 {
+			segs = append(segs, segment{br: true})
+		}
+		segs = append(segs, l...)
+	}
+	content = trimContent(normalize(joinContent(segs), NormalizeBreaks))
+	if multiline && len(kept) == 1 {
+		content = trimContent(mapFirstText(content, func(s string) string {
+			return dashRe.ReplaceAllString(s, "$1")
+		}))
+	}
+	return content
+}
+
+// mapFirstText applies f to the first run of text in markup that is not
+// only whitespace.
+func mapFirstText(markup string, f func(string) string) string {
+	done := false
+	return mapText(markup, func(s string) string {
+		if done || strings.TrimSpace(s) == "" {
+			return s
+		}
+		done = true
+		return f(s)
+	})
+}
+
+// mergeRepeats merges each cue into the cue before it when both have the
+// same text, region and styles and at most maxGap separates them. Cues are
+// sorted by begin time first.
+func mergeRepeats(doc *parser.ITTDocument, maxGap time.Duration) []parser.Diagnostic {
+	if len(doc.Cues) == 0 {
+		return nil
+	}
+	sortCues(doc.Cues)
+	gapLimit := big.NewRat(maxGap.Milliseconds(), 1)
+	var diags []parser.Diagnostic
+	out := []parser.Cue{doc.Cues[0]}
+	for i := 1; i < len(doc.Cues); i++ {
+		cur, next := &out[len(out)-1], &doc.Cues[i]
+		gap := new(big.Rat).Sub(next.Begin, cur.End)
+		if gap.Sign() < 0 || gap.Cmp(gapLimit) > 0 || cur.RegionID != next.RegionID ||
+			strings.Join(cur.StyleIDs, " ") != strings.Join(next.StyleIDs, " ") ||
+			visibleText(cur.Content) != visibleText(next.Content) {
+			out = append(out, *next)
+			continue
+		}
+		diags = append(diags, diagnose(doc, next, "merged into "+cur.Name(), "%s repeats the text of %s", next.Name(), cur.Name()))
+		if next.End.Cmp(cur.End) > 0 {
+			cur.End = next.End
+		}
+	}
+	doc.Cues = out
+	return diags
+}
@@ -0,0 +1,274 @@
+package transform
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// SplitOptions configures SplitCues. A zero limit is not enforced.
+type SplitOptions struct {
+	MaxDuration time.Duration // longest a cue may last
+	MaxChars    int           // most characters a cue may hold
+}
+
+// MergeOptions configures MergeCues.
+type MergeOptions struct {
+	// MinDuration is the duration below which a cue is merged with the cue
+	// that follows it. Zero disables merging.
+	MinDuration time.Duration
+	// MaxGap is the largest gap between two cues that are merged.
+	MaxGap time.Duration
+	// Limits caps the merged cue; merges that would exceed it are skipped.
+	Limits SplitOptions
+}
+
+// sentenceEndRe matches the end of a sentence and the space after it.
+var sentenceEndRe = regexp.MustCompile(`[.?!…]+["'”’)]*\s+`)
+
+// chunk is a part of a cue's content that can be shown on its own, along with
+// the separator that joins it to the next chunk.
+type chunk struct {
+	markup string
+	sep    string // "<br/>" after a line, " " after a sentence
+	chars  int
+}
+
+// chunks splits content at top-level line breaks and sentence ends.
+func chunks(content string) []chunk {
+	var out []chunk
+	var cur strings.Builder
+	flush := func(sep string) {
+		markup := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if markup == "" {
+			return
+		}
+		out = append(out, chunk{markup: markup, sep: sep, chars: visibleLen(markup)})
+	}
+	for _, seg := range parseContent(content) {
+		switch {
+		case seg.br:
+			flush("<br/>")
+		case seg.elem:
+			cur.WriteString(seg.raw)
+		default:
+			text := seg.raw
+			for loc := sentenceEndRe.FindStringIndex(text); loc != nil; loc = sentenceEndRe.FindStringIndex(text) {
+				cur.WriteString(text[:loc[1]])
+				flush(" ")
+				text = text[loc[1]:]
+			}
+			cur.WriteString(text)
+		}
+	}
+	flush("")
+	return out
+}
+
+// SplitCues splits each cue that exceeds a limit of opts into consecutive
+// cues at line breaks and sentence ends, balancing the characters of the
+// parts. Each part's share of the cue's time is proportional to its share of
+// the characters. Cues are sorted by begin time first.
+func SplitCues(doc *parser.ITTDocument, opts SplitOptions) []parser.Diagnostic {
+	if opts.MaxDuration <= 0 && opts.MaxChars <= 0 {
+		return nil
+	}
+	sortCues(doc.Cues)
+	var diags []parser.Diagnostic
+	var out []parser.Cue
+	for i := range doc.Cues {
+		cue := &doc.Cues[i]
+		duration := new(big.Rat).Sub(cue.End, cue.Begin)
+		parts := chunks(cue.Content)
+		chars := 0
+		for _, c := range parts {
+			chars += c.chars
+		}
+		n := partsNeeded(duration, chars, opts)
+		if n <= 1 {
+			out = append(out, *cue)
+			continue
+		}
+		problem := fmt.Sprintf("%s lasts %s ms and has %d characters", cue.Name(), parser.FormatMs(duration), chars)
+		if len(parts) < 2 {
+			diags = append(diags, diagnose(doc, cue, "kept cue", "%s, but has no line or sentence break to split at", problem))
+			out = append(out, *cue)
+			continue
+		}
+		if n > len(parts) {
+			n = len(parts)
+		}
+		split := splitCue(cue, parts, chars, balance(parts, chars, n))
+		diags = append(diags, diagnose(doc, cue, fmt.Sprintf("split into %d cues", len(split)), "%s", problem))
+		out = append(out, split...)
+	}
+	doc.Cues = out
+	return diags
+}
+
+// partsNeeded returns how many cues are needed to bring a cue of the given
+// duration and character count within opts.
+func partsNeeded(duration *big.Rat, chars int, opts SplitOptions) int {
+	n := 1
+	if opts.MaxChars > 0 {
+		n = max(n, (chars+opts.MaxChars-1)/opts.MaxChars)
+	}
+	if opts.MaxDuration > 0 {
+		limit := durationMs(opts.MaxDuration)
+		q := new(big.Rat).Quo(duration, limit)
+		parts := new(big.Int).Quo(q.Num(), q.Denom())
+		if !q.IsInt() {
+			parts.Add(parts, big.NewInt(1))
+		}
+		n = max(n, int(parts.Int64()))
+	}
+	return n
+}
+
+// balance returns the indexes of the chunks that start each of n groups, so
+// that the groups hold about the same number of characters.
+func balance(parts []chunk, chars, n int) []int {
+	starts := []int{0}
+	cum := 0
+	next := 1
+	for i := 0; i < len(parts)-1 && len(starts) < n; i++ {
+		cum += parts[i].chars
+		target := chars * next / n
+		// Cut after chunk i if that lands at least as close to the target as
+		// cutting after chunk i+1, or if the remaining chunks are all needed.
+		after := cum + parts[i+1].chars
+		remainingChunks := len(parts) - 1 - i
+		remainingGroups := n - len(starts)
+		if abs(cum-target) <= abs(after-target) || remainingChunks <= remainingGroups {
+			starts = append(starts, i+1)
+			next++
+		}
+	}
+	return starts
+}
+
+// splitCue builds the cues for the chunk groups beginning at starts.
+func splitCue(cue *parser.Cue, parts []chunk, chars int, starts []int) []parser.Cue {
+	duration := new(big.Rat).Sub(cue.End, cue.Begin)
+	var out []parser.Cue
+	begin := cue.Begin
+	done := 0
+	for g, start := range starts {
+		end := len(parts)
+		if g+1 < len(starts) {
+			end = starts[g+1]
+		}
+		var sb strings.Builder
+		for i := start; i < end; i++ {
+			sb.WriteString(parts[i].markup)
+			if i+1 < end {
+				sb.WriteString(parts[i].sep)
+			}
+			done += parts[i].chars
+		}
+
+		part := *cue
+		if g > 0 && cue.ID != "" {
+			part.ID = fmt.Sprintf("%s-%d", cue.ID, g+1)
+		}
+		part.Content = sb.String()
+		part.Begin = begin
+		if end == len(parts) {
+			part.End = cue.End
+		} else {
+			share := big.NewRat(int64(done), int64(max(chars, 1)))
+			part.End = roundMs(new(big.Rat).Add(cue.Begin, new(big.Rat).Mul(duration, share)))
+		}
+		begin = part.End
+		out = append(out, part)
+	}
+	return out
+}
+
+// MergeCues merges each cue shorter than opts.MinDuration with the cue that
+// follows it, when both share a region, styles, language, direction, agents
+// and role and the gap between them is at most opts.MaxGap. The merged text
+// is joined with a space. A merged cue keeps taking in the cues that follow
+// only while it is shorter than opts.MinDuration, and never beyond
+// opts.Limits. Cues are sorted by begin time first.
+func MergeCues(doc *parser.ITTDocument, opts MergeOptions) []parser.Diagnostic {
+	if opts.MinDuration <= 0 || len(doc.Cues) == 0 {
+		return nil
+	}
+	sortCues(doc.Cues)
+	minDuration := durationMs(opts.MinDuration)
+	maxGap := durationMs(opts.MaxGap)
+	short := func(c *parser.Cue) bool {
+		return new(big.Rat).Sub(c.End, c.Begin).Cmp(minDuration) < 0
+	}
+
+	var diags []parser.Diagnostic
+	var out []parser.Cue
+	var texts []string // text of the cues merged into the last cue of out
+	chars := 0         // visible characters of texts joined with spaces
+	finish := func() {
+		if len(texts) > 1 {
+			out[len(out)-1].Content = strings.Join(texts, " ")
+		}
+	}
+	for i := range doc.Cues {
+		next := &doc.Cues[i]
+		text := trimContent(next.Content)
+		nextChars := visibleLen(text)
+		if len(out) > 0 {
+			cur := &out[len(out)-1]
+			merged := chars + nextChars
+			if chars > 0 && nextChars > 0 {
+				merged++ // the joining space
+			}
+			gap := new(big.Rat).Sub(next.Begin, cur.End)
+			if (short(cur) || short(next) && len(texts) == 1) && gap.Sign() >= 0 && gap.Cmp(maxGap) <= 0 &&
+				mergeable(cur, next) && partsNeeded(new(big.Rat).Sub(next.End, cur.Begin), merged, opts.Limits) <= 1 {
+				action := "merged into " + cur.Name()
+				if short(next) {
+					diags = append(diags, diagnose(doc, next, action, "%s lasts %s ms", next.Name(), parser.FormatMs(new(big.Rat).Sub(next.End, next.Begin))))
+				} else {
+					diags = append(diags, diagnose(doc, next, action, "%s follows %s, which lasts %s ms", next.Name(), cur.Name(), parser.FormatMs(new(big.Rat).Sub(cur.End, cur.Begin))))
+				}
+				cur.End = next.End
+				texts = append(texts, text)
+				chars = merged
+				continue
+			}
+			finish()
+		}
+		out = append(out, *next)
+		texts = append(texts[:0], text)
+		chars = nextChars
+	}
+	finish()
+	doc.Cues = out
+	return diags
+}
+
+// mergeable reports whether two cues may be shown as one: they share a
+// region, styles, language, direction, agents and role.
+func mergeable(a, b *parser.Cue) bool {
+	return a.RegionID == b.RegionID && slices.Equal(a.StyleIDs, b.StyleIDs) &&
+		a.Lang == b.Lang && a.Direction == b.Direction &&
+		slices.Equal(a.Agents, b.Agents) && a.Role == b.Role
+}
+
+// roundMs rounds a time in milliseconds to a whole millisecond.
+func roundMs(ms *big.Rat) *big.Rat {
+	f, _ := ms.Float64()
+	return big.NewRat(int64(f+0.5), 1)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+// Package transform rewrites the cues of a parsed ITTDocument before it is
+// converted: resolving overlaps, enforcing gaps between cues, splitting,
+// merging and rewrapping cues, cleaning up their text and stripping sound
+// descriptions from subtitles for the deaf and hard of hearing. Every
+// transform records the cues it changes as diagnostics in
+// ITTDocument.Diagnostics and returns them, so callers can report what was
+// modified.
+package transform
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// diagnose records a change to cue in doc and returns the diagnostic.
+func diagnose(doc *parser.ITTDocument, cue *parser.Cue, action, format string, args ...any) parser.Diagnostic {
+	d := parser.Diagnostic{
+		Err: &parser.ParseError{
+			Line:    cue.Pos.Line,
+			Column:  cue.Pos.Column,
+			Offset:  cue.Pos.Offset,
+			Element: "p",
+			Err:     fmt.Errorf(format, args...),
+		},
+		Action: action,
+	}
+	doc.Diagnostics = append(doc.Diagnostics, d)
+	return d
+}
+
+// sortCues orders cues by begin time, keeping the source order of cues that
+// begin together. A missing begin or end is set to zero first, so every
+// transform that sorts can compare times safely.
+func sortCues(cues []parser.Cue) {
+	parser.ZeroMissingTimes(cues)
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].Begin.Cmp(cues[j].Begin) < 0
+	})
+}
+
+// durationMs converts d to milliseconds, keeping fractions of a millisecond.
+func durationMs(d time.Duration) *big.Rat {
+	return big.NewRat(int64(d), int64(time.Millisecond))
+}
+
+// sortIndexes orders indexes into cues by the begin time of the cue, after
+// setting a missing begin or end to zero like sortCues.
+func sortIndexes(cues []parser.Cue, indexes []int) {
+	parser.ZeroMissingTimes(cues)
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return cues[indexes[i]].Begin.Cmp(cues[indexes[j]].Begin) < 0
+	})
+}
@@ -0,0 +1,621 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/timecode"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func cue(id string, begin, end int64, content string) parser.Cue {
+	return parser.Cue{ID: id, Begin: big.NewRat(begin, 1), End: big.NewRat(end, 1), Content: content}
+}
+
+// timings summarizes cues as "id begin-end region: content".
+func timings(cues []parser.Cue) []string {
+	var out []string
+	for _, c := range cues {
+		s := c.ID + " " + c.Begin.FloatString(0) + "-" + c.End.FloatString(0)
+		if c.RegionID != "" {
+			s += " " + c.RegionID
+		}
+		if c.Content != "" {
+			s += ": " + c.Content
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func diagnostics(diags []parser.Diagnostic) []string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func TestFindOverlaps(t *testing.T) {
+	cues := []parser.Cue{
+		cue("c3", 2500, 3000, ""),
+		cue("c1", 0, 2000, ""),
+		cue("c2", 1500, 2600, ""),
+		cue("c4", 3000, 4000, ""),
+	}
+	var got []string
+	for _, o := range FindOverlaps(cues) {
+		got = append(got, cues[o.First].ID+"/"+cues[o.Second].ID+" "+o.Duration.FloatString(0))
+	}
+	want := []string{"c1/c2 500", "c2/c3 100"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindOverlaps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveOverlaps_Untimed(t *testing.T) {
+	for _, strategy := range []OverlapStrategy{OverlapTrim, OverlapMerge, OverlapStack} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			untimed := parser.Cue{ID: "c0", Content: "No timing"}
+			doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 2000, "A"), untimed, cue("c2", 1000, 3000, "B")}}
+			ResolveOverlaps(doc, strategy)
+			if doc.Cues[0].Begin == nil || doc.Cues[0].End == nil {
+				t.Errorf("Expected the untimed cue to get zero times, got %+v", doc.Cues[0])
+			}
+		})
+	}
+	doc := &parser.ITTDocument{
+		FrameRateValue: &timecode.FrameRate{Rat: big.NewRat(25, 1)},
+		Cues:           []parser.Cue{{ID: "c0"}, cue("c1", 0, 2000, "A")},
+	}
+	MergeCues(doc, MergeOptions{MinDuration: time.Second})
+	SplitCues(doc, SplitOptions{MaxDuration: time.Second})
+	if _, err := EnforceGaps(doc, GapOptions{MinGapFrames: 2}); err != nil {
+		t.Errorf("EnforceGaps failed: %v", err)
+	}
+}
+
+func TestFindOverlaps_Nested(t *testing.T) {
+	cues := []parser.Cue{
+		cue("c1", 0, 10000, ""),
+		cue("c2", 1000, 2000, ""),
+		cue("c3", 3000, 4000, ""),
+		cue("c4", 10000, 11000, ""),
+	}
+	var got []string
+	for _, o := range FindOverlaps(cues) {
+		got = append(got, cues[o.First].ID+"/"+cues[o.Second].ID+" "+o.Duration.FloatString(0))
+	}
+	want := []string{"c1/c2 1000", "c1/c3 1000"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindOverlaps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveOverlaps(t *testing.T) {
+	tests := []struct {
+		strategy    OverlapStrategy
+		want        []string
+		wantDiags   []string
+		wantRegions []string
+	}{
+		{
+			strategy: OverlapKeep,
+			want:     []string{"c2 1000-3000: B", "c1 0-2000 r1: A", "c3 1000-1500: C"},
+		},
+		{
+			strategy: OverlapTrim,
+			want:     []string{"c1 0-1000 r1: A", "c2 1000-3000: B", "c3 1000-1500: C"},
+			wantDiags: []string{
+				"<p>: cue c1 overlaps cue c2 by 1000 ms (trimmed end to 1000 ms)",
+				"<p>: cue c3 begins together with cue c2 and cannot be trimmed (kept overlap)",
+			},
+		},
+		{
+			strategy: OverlapMerge,
+			want: []string{
+				"c1 0-1000 r1: A",
+				`c1 1000-1500 r1: A<br/><span style="s1">B</span><br/>C`,
+				`c1 1500-2000 r1: A<br/><span style="s1">B</span>`,
+				"c2 2000-3000: B",
+			},
+			wantDiags: []string{
+				"<p>: cue c2 overlaps cue c1 by 1000 ms (merged into multi-line cues)",
+				"<p>: cue c3 overlaps cue c1 by 500 ms (merged into multi-line cues)",
+				"<p>: cue c3 overlaps cue c2 by 500 ms (merged into multi-line cues)",
+			},
+		},
+		{
+			strategy: OverlapStack,
+			want:     []string{"c1 0-2000 r1: A", "c2 1000-3000 stack-stack1: B", "c3 1000-1500 stack-stack2: C"},
+			wantDiags: []string{
+				"<p>: cue c2 overlaps cue c1 (moved to region stack-stack1)",
+				"<p>: cue c3 overlaps cue c1 (moved to region stack-stack2)",
+			},
+			wantRegions: []string{"r1 10% 80%", "stack-stack1 10% 70%", "stack-stack2 10% 60%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy.String(), func(t *testing.T) {
+			b := cue("c2", 1000, 3000, "B")
+			b.StyleIDs = []string{"s1"}
+			a := cue("c1", 0, 2000, "A")
+			a.RegionID = "r1"
+			doc := &parser.ITTDocument{
+				Regions: map[string]parser.Region{"r1": {ID: "r1", Origin: "10% 80%", Extent: "80% 20%"}},
+				Cues:    []parser.Cue{b, a, cue("c3", 1000, 1500, "C")},
+			}
+			diags := ResolveOverlaps(doc, tt.strategy)
+			if diff := cmp.Diff(tt.want, timings(doc.Cues)); diff != "" {
+				t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantDiags, diagnostics(diags)); diff != "" {
+				t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+			}
+			if len(doc.Diagnostics) != len(diags) {
+				t.Errorf("Expected %d diagnostics recorded in the document, got %d", len(diags), len(doc.Diagnostics))
+			}
+			if tt.wantRegions != nil {
+				var regions []string
+				for _, id := range []string{"r1", "stack-stack1", "stack-stack2"} {
+					regions = append(regions, id+" "+doc.Regions[id].Origin)
+				}
+				if diff := cmp.Diff(tt.wantRegions, regions); diff != "" {
+					t.Errorf("Regions mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveOverlaps_MergeChain(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{
+		cue("c1", 0, 2000, "A"),
+		cue("c2", 1000, 1000, "B"),
+		cue("c3", 1500, 3000, "C"),
+		cue("c4", 2500, 4000, "D"),
+	}}
+	diags := ResolveOverlaps(doc, OverlapMerge)
+
+	want := []string{
+		"c1 0-1500: A",
+		"c1 1500-2000: A<br/>C",
+		"c3 2000-2500: C",
+		"c3 2500-3000: C<br/>D",
+		"c4 3000-4000: D",
+	}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	if got := diagnostics(diags); len(got) != 4 || got[3] != "<p>: cue c2 lasts no time and is hidden by the cues it overlaps (dropped cue)" {
+		t.Errorf("Expected the empty cue to be reported as dropped, got %v", got)
+	}
+}
+
+func TestParseOverlapStrategy(t *testing.T) {
+	for _, s := range []OverlapStrategy{OverlapKeep, OverlapTrim, OverlapMerge, OverlapStack} {
+		got, err := ParseOverlapStrategy(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseOverlapStrategy(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseOverlapStrategy("shuffle"); err == nil || !strings.Contains(err.Error(), "shuffle") {
+		t.Errorf("Expected an error naming the unknown strategy, got %v", err)
+	}
+}
+
+func TestEnforceGaps(t *testing.T) {
+	doc := &parser.ITTDocument{
+		FrameRateValue: &timecode.FrameRate{Rat: big.NewRat(25, 1)}, // 40 ms per frame
+		Cues: []parser.Cue{
+			cue("c1", 0, 1000, ""),
+			cue("c3", 2400, 3000, ""),
+			cue("c2", 1040, 2000, ""),
+			cue("c4", 3080, 3100, ""),
+			cue("c5", 3120, 4000, ""),
+			cue("c6", 5000, 6000, ""),
+			cue("c7", 5500, 6500, ""),
+		},
+	}
+	diags, err := EnforceGaps(doc, GapOptions{MinGapFrames: 2, ChainFrames: 12})
+	if err != nil {
+		t.Fatalf("EnforceGaps failed: %v", err)
+	}
+
+	want := []string{"c1 0-960", "c2 1040-2320", "c3 2400-3000", "c4 3080-3100", "c5 3120-4000", "c6 5000-6000", "c7 5500-6500"}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: gap before cue c2 is 1 frames (trimmed end to 960 ms)",
+		"<p>: gap before cue c3 is 10 frames (extended end to 2320 ms)",
+		"<p>: gap before cue c5 is 0.50 frames, but cue c4 is too short to trim (kept gap)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnforceGaps_Disabled(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 1000, ""), cue("c2", 1010, 2000, "")}}
+	diags, err := EnforceGaps(doc, GapOptions{})
+	if err != nil || diags != nil {
+		t.Errorf("Expected no changes with zero options, got %v, %v", diags, err)
+	}
+	if _, err := EnforceGaps(doc, GapOptions{MinGapFrames: 2}); !errors.Is(err, errs.ErrMissingFrameRate) {
+		t.Errorf("Expected ErrMissingFrameRate without a frame rate, got %v", err)
+	}
+}
+
+func TestSplitCues(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			cue("c1", 0, 8000, "First sentence here. Second one<br/>and <span style=\"s1\">a third. Still</span> going"),
+			cue("c2", 10000, 20000, "One long line without any break at all"),
+			cue("c3", 20000, 21000, "Short."),
+		},
+	}
+	diags := SplitCues(doc, SplitOptions{MaxDuration: 5 * time.Second, MaxChars: 40})
+
+	want := []string{
+		"c1 0-4444: First sentence here. Second one",
+		`c1-2 4444-8000: and <span style="s1">a third. Still</span> going`,
+		"c2 10000-20000: One long line without any break at all",
+		"c3 20000-21000: Short.",
+	}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: cue c1 lasts 8000 ms and has 54 characters (split into 2 cues)",
+		"<p>: cue c2 lasts 10000 ms and has 38 characters, but has no line or sentence break to split at (kept cue)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSplitCues_Balanced(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 9000, "One. Two. Three. Four. Five. Six.")}}
+	SplitCues(doc, SplitOptions{MaxChars: 12})
+	want := []string{"c1 0-2571: One. Two.", "c1-2 2571-6107: Three. Four.", "c1-3 6107-9000: Five. Six."}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSplitCues_SubMillisecond(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 1, "One. Two.")}}
+	SplitCues(doc, SplitOptions{MaxDuration: 500 * time.Microsecond})
+	want := []string{"c1 0-1: One.", "c1-2 1-1: Two."}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeCues(t *testing.T) {
+	styled := cue("c5", 4000, 4300, "styled")
+	styled.StyleIDs = []string{"s1"}
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			cue("c1", 0, 300, "Hey"),
+			cue("c2", 300, 600, "&#xA; you! &#xA;"),
+			cue("c3", 640, 2000, "Come here."),
+			cue("c4", 3000, 3300, "Far"),
+			styled,
+			cue("c6", 5000, 9000, "A long cue that would grow too much"),
+			cue("c7", 9000, 9200, "if merged"),
+		},
+	}
+	diags := MergeCues(doc, MergeOptions{MinDuration: time.Second, MaxGap: 100 * time.Millisecond, Limits: SplitOptions{MaxChars: 40}})
+
+	want := []string{
+		"c1 0-2000: Hey you! Come here.",
+		"c4 3000-3300: Far",
+		"c5 4000-4300: styled",
+		"c6 5000-9000: A long cue that would grow too much",
+		"c7 9000-9200: if merged",
+	}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: cue c2 lasts 300 ms (merged into cue c1)",
+		"<p>: cue c3 follows cue c1, which lasts 600 ms (merged into cue c1)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeCues_Bounded(t *testing.T) {
+	var cues []parser.Cue
+	for i := range int64(6) {
+		cues = append(cues, cue(fmt.Sprintf("c%d", i+1), i*400, i*400+400, fmt.Sprint(i+1)))
+	}
+	cues[5].RegionID = "top"
+	doc := &parser.ITTDocument{Cues: cues}
+	diags := MergeCues(doc, MergeOptions{MinDuration: time.Second})
+
+	want := []string{"c1 0-1200: 1 2 3", "c4 1200-2000: 4 5", "c6 2000-2400 top: 6"}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	if len(diags) != 3 {
+		t.Errorf("Expected 3 diagnostics, got %v", diagnostics(diags))
+	}
+}
+
+func TestMergeCues_Mismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(*parser.Cue)
+	}{
+		{"Region", func(c *parser.Cue) { c.RegionID = "top" }},
+		{"Styles", func(c *parser.Cue) { c.StyleIDs = []string{"s1"} }},
+		{"Direction", func(c *parser.Cue) { c.Direction = "rtl" }},
+		{"Language", func(c *parser.Cue) { c.Lang = "fr" }},
+		{"Agents", func(c *parser.Cue) { c.Agents = []string{"bob"} }},
+		{"Role", func(c *parser.Cue) { c.Role = "sound" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 400, "One"), cue("c2", 400, 800, "two")}}
+			tt.set(&doc.Cues[1])
+			MergeCues(doc, MergeOptions{MinDuration: time.Second})
+			if len(doc.Cues) != 2 {
+				t.Errorf("Expected cues with different %s to stay apart, got %v", strings.ToLower(tt.name), timings(doc.Cues))
+			}
+		})
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			cue("c1", 0, 1000, "Short enough"),
+			cue("c2", 1000, 2000, "&#xA;  This sentence is far too long for one line&#10;"),
+			cue("c3", 2000, 3000, `Keep <span style="s1">this styled phrase</span> together, please`),
+			cue("c4", 3000, 4000, "Hard break<br/>kept even though the second line is long"),
+			cue("c5", 4000, 5000, "One two three four five six seven eight nine ten eleven"),
+		},
+	}
+	diags := WrapLines(doc, WrapOptions{MaxChars: 24, MaxLines: 2})
+
+	want := []string{
+		"c1 0-1000: Short enough",
+		"c2 1000-2000: This sentence is far<br/>too long for one line",
+		`c3 2000-3000: Keep <span style="s1">this styled phrase</span><br/>together, please`,
+		"c4 3000-4000: Hard break<br/>kept even though the<br/>second line is long",
+		"c5 4000-5000: One two three<br/>four five six seven<br/>eight nine ten eleven",
+	}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: line 1 has 42 characters, at most 24 allowed (rewrapped to 2 lines)",
+		"<p>: line 1 has 40 characters, at most 24 allowed (rewrapped to 2 lines)",
+		"<p>: line 2 has 40 characters, at most 24 allowed, and the text needs 3 lines, at most 2 allowed (rewrapped to 3 lines)",
+		"<p>: line 1 has 55 characters, at most 24 allowed, and the text needs 3 lines, at most 2 allowed (rewrapped to 3 lines)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWrapLines_BottomHeavy(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 1000, "aaaa bbbb cccc dddd eeee")}}
+	WrapLines(doc, WrapOptions{MaxChars: 20})
+	if got, want := doc.Cues[0].Content, "aaaa bbbb<br/>cccc dddd eeee"; got != want {
+		t.Errorf("Expected the longer line at the bottom, got %q, want %q", got, want)
+	}
+}
+
+func TestWrapLines_NonASCII(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{
+		cue("c1", 0, 1000, `Voilà<span style="s1">!</span> Ça y est, c'est fini, ÅSA`),
+	}}
+	WrapLines(doc, WrapOptions{MaxChars: 20})
+	if got, want := doc.Cues[0].Content, `Voilà<span style="s1">!</span> Ça y est,<br/>c'est fini, ÅSA`; got != want {
+		t.Errorf("Expected words to end at spaces only, got %q, want %q", got, want)
+	}
+}
+
+func TestWrapLines_LongCue(t *testing.T) {
+	words := make([]string, 200)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i%10)
+	}
+	doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 1000, strings.Join(words, " "))}}
+
+	start := time.Now()
+	WrapLines(doc, WrapOptions{MaxChars: 20})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected a 200-word cue to wrap quickly, took %s", elapsed)
+	}
+	lines := strings.Split(doc.Cues[0].Content, "<br/>")
+	if len(lines) != 29 {
+		t.Errorf("Expected 29 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) > 20 {
+			t.Errorf("Expected lines of at most 20 characters, got %q", line)
+		}
+	}
+}
+
+func TestStripSDH(t *testing.T) {
+	sound := cue("c5", 4000, 5000, "Thunder rumbles")
+	sound.Role = "sound"
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			cue("c1", 0, 1000, "[door slams]"),
+			cue("c2", 1000, 2000, "- JOHN: Who's there?<br/>- [whispering] (quietly) It's me."),
+			cue("c3", 2000, 3000, "- Hello?<br/>- <span style=\"it\">[laughs]</span>"),
+			cue("c4", 3000, 4000, "♪ La la la ♪"),
+			sound,
+			cue("c6", 5000, 6000, "<span ttm:role=\"sound\">BANG</span> Note: it's 10:30 (sharp)"),
+			cue("c7", 6000, 7000, "[phone<br/>rings] Wait."),
+			cue("c8", 7000, 8000, "Wait.<br/>(phone stops)"),
+			cue("c9", 9000, 10000, "Keep (this"),
+		},
+	}
+	diags := StripSDH(doc, SDHOptions{Merge: true})
+
+	want := []string{
+		"c2 1000-2000: - Who's there?<br/>- It's me.",
+		"c3 2000-3000: Hello?",
+		"c4 3000-4000: La la la",
+		"c6 5000-6000: Note: it's 10:30",
+		"c7 6000-8000: Wait.",
+		"c9 9000-10000: Keep (this",
+	}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: cue c1 holds only sound descriptions (removed)",
+		"<p>: cue c5 is a sound description (removed)",
+		"<p>: cue c8 repeats the text of cue c7 (merged into cue c7)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStripSDH_Untimed(t *testing.T) {
+	doc := &parser.ITTDocument{Cues: []parser.Cue{
+		{Content: "[door slams]"},
+		{Content: "Wait."},
+		cue("c1", 0, 1000, "Wait."),
+	}}
+	diags := StripSDH(doc, SDHOptions{Merge: true, MaxGap: time.Second})
+
+	want := []string{" 0-1000: Wait."}
+	if diff := cmp.Diff(want, timings(doc.Cues)); diff != "" {
+		t.Errorf("Cues mismatch (-want +got):\n%s", diff)
+	}
+	wantDiags := []string{
+		"<p>: the cue at 0 ms holds only sound descriptions (removed)",
+		"<p>: cue c1 repeats the text of the cue at 0 ms (merged into the cue at 0 ms)",
+	}
+	if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+		t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   NormalizeRule
+		applied NormalizeRule // rules that change the input, if not all of them
+		input   string
+		want    string
+	}{
+		{
+			name:  "Indent",
+			rules: NormalizeIndent,
+			input: "&#xA;        First line&#xA;        continues  here<br/>&#xA;   next&#xA;      ",
+			want:  "First line continues  here<br/> next",
+		},
+		{
+			name:  "Spaces",
+			rules: NormalizeSpaces,
+			input: "Too   many \t spaces <span>in  here</span>",
+			want:  "Too many spaces <span>in here</span>",
+		},
+		{
+			name:  "Breaks",
+			rules: NormalizeBreaks,
+			input: "Line one  <br/>  line two <br /> three",
+			want:  "Line one<br/>line two<br/>three",
+		},
+		{
+			name:  "Default",
+			rules: DefaultNormalizeRules,
+			input: "&#xA;    Hello   there &#xA;  <br/>  General&#xA;",
+			want:  "Hello there<br/>General",
+		},
+		{
+			name:  "CurlyQuotes",
+			rules: NormalizeCurlyQuotes,
+			input: `&#34;It&#39;s <i>'fine'</i>,&#34; he said.`,
+			want:  `“It’s <i>‘fine’</i>,” he said.`,
+		},
+		{
+			name:    "StraightQuotes",
+			rules:   NormalizeStraightQuotes | NormalizeCurlyQuotes,
+			applied: NormalizeStraightQuotes,
+			input:   `“It’s fine,” he said &amp; left.`,
+			want:    `"It's fine," he said &amp; left.`,
+		},
+		{
+			name:  "Ellipsis",
+			rules: NormalizeEllipsis,
+			input: "Wait... what...?",
+			want:  "Wait… what…?",
+		},
+		{
+			name:  "Dashes",
+			rules: NormalizeDashes,
+			input: "–Where?<br/>-Here.<br/>A well-known place",
+			want:  "- Where?<br/>- Here.<br/>A well-known place",
+		},
+		{
+			name:  "DashesBeforeSpansAndQuotes",
+			rules: NormalizeDashes,
+			input: "-<i>Where?</i><br/>—“Here.”<br/>-5 degrees",
+			want:  "- <i>Where?</i><br/>- “Here.”<br/>-5 degrees",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &parser.ITTDocument{Cues: []parser.Cue{cue("c1", 0, 1000, tt.input), cue("c2", 1000, 2000, "Clean")}}
+			diags := NormalizeText(doc, tt.rules)
+			if got := doc.Cues[0].Content; got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			applied := tt.applied
+			if applied == 0 {
+				applied = tt.rules
+			}
+			wantDiags := []string{fmt.Sprintf("<p>: cue c1 has text to clean up (%s) (normalized)", applied)}
+			if diff := cmp.Diff(wantDiags, diagnostics(diags)); diff != "" {
+				t.Errorf("Diagnostics mismatch (-want +got):\n%s", diff)
+			}
+			if len(doc.Diagnostics) != len(diags) {
+				t.Errorf("Expected %d diagnostics recorded in the document, got %d", len(diags), len(doc.Diagnostics))
+			}
+		})
+	}
+}
+
+func TestParseNormalizeRules(t *testing.T) {
+	rules, err := ParseNormalizeRules([]string{"spaces", "curly-quotes"})
+	if err != nil || rules != NormalizeSpaces|NormalizeCurlyQuotes {
+		t.Errorf("ParseNormalizeRules = %v, %v", rules, err)
+	}
+	if got, want := rules.String(), "spaces,curly-quotes"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if _, err := ParseNormalizeRules([]string{"smart"}); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+}
+
+func TestTextLines(t *testing.T) {
+	got := TextLines("  Hello\n  <span tts:fontStyle=\"italic\">there</span>,<br/>General &lt;Kenobi&gt;<br />")
+	want := []string{"Hello there,", "General <Kenobi>", ""}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TextLines mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,209 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+)
+
+// WrapOptions configures WrapLines.
+type WrapOptions struct {
+	// MaxChars is the most characters a line may hold. Zero disables
+	// wrapping.
+	MaxChars int
+	// MaxLines is the most lines a cue should have. Zero means no limit.
+	MaxLines int
+}
+
+// word is an unbreakable run of cue content with its displayed length.
+type word struct {
+	markup string
+	chars  int
+}
+
+// WrapLines rewraps the cues that have a line longer than opts.MaxChars.
+// Existing <br/> breaks are kept; each line that is too long is broken at
+// spaces outside of elements, so a styled span is never split, into as few
+// lines as fit, preferring bottom-heavy layouts where the lower line is the
+// longer one. Cues whose lines all fit are left untouched. A cue that still
+// needs more than opts.MaxLines lines is wrapped anyway and reported.
+func WrapLines(doc *parser.ITTDocument, opts WrapOptions) []parser.Diagnostic {
+	if opts.MaxChars <= 0 {
+		return nil
+	}
+	var diags []parser.Diagnostic
+	for i := range doc.Cues {
+		cue := &doc.Cues[i]
+		blocks := lineWords(cue.Content)
+		longest, longestLine := 0, 0
+		for n, block := range blocks {
+			if l := lineLength(block); l > longest {
+				longest, longestLine = l, n+1
+			}
+		}
+		if longest <= opts.MaxChars {
+			continue
+		}
+
+		var lines []string
+		for _, block := range blocks {
+			for _, line := range wrapWords(block, opts.MaxChars) {
+				var parts []string
+				for _, w := range line {
+					parts = append(parts, w.markup)
+				}
+				lines = append(lines, strings.Join(parts, " "))
+			}
+		}
+		cue.Content = strings.Join(lines, "<br/>")
+
+		problem := fmt.Sprintf("line %d has %d characters, at most %d allowed", longestLine, longest, opts.MaxChars)
+		action := fmt.Sprintf("rewrapped to %d lines", len(lines))
+		if opts.MaxLines > 0 && len(lines) > opts.MaxLines {
+			problem += fmt.Sprintf(", and the text needs %d lines, at most %d allowed", len(lines), opts.MaxLines)
+		}
+		diags = append(diags, diagnose(doc, cue, action, "%s", problem))
+	}
+	return diags
+}
+
+// lineWords splits content at top-level <br/> breaks into lines of words.
+// Words are separated by whitespace outside of elements.
+func lineWords(content string) [][]word {
+	var lines [][]word
+	var line []word
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			line = append(line, word{markup: cur.String(), chars: visibleLen(cur.String())})
+			cur.Reset()
+		}
+	}
+	for _, seg := range parseContent(content) {
+		switch {
+		case seg.br:
+			flush()
+			lines = append(lines, line)
+			line = nil
+		case seg.elem:
+			cur.WriteString(seg.raw)
+		default:
+			fields := strings.Fields(seg.raw)
+			if r, _ := utf8.DecodeRuneInString(seg.raw); unicode.IsSpace(r) {
+				flush()
+			}
+			for n, f := range fields {
+				if n > 0 {
+					flush()
+				}
+				cur.WriteString(f)
+			}
+			if r, _ := utf8.DecodeLastRuneInString(seg.raw); unicode.IsSpace(r) {
+				flush()
+			}
+		}
+	}
+	flush()
+	return append(lines, line)
+}
+
+// lineLength returns the displayed length of words joined by spaces.
+func lineLength(words []word) int {
+	n := 0
+	for i, w := range words {
+		if i > 0 {
+			n++
+		}
+		n += w.chars
+	}
+	return n
+}
+
+// wrapWords breaks words into the fewest lines of at most maxChars
+// characters, choosing among the breaks that achieve this the most
+// bottom-heavy one. A word longer than maxChars gets a line of its own.
+func wrapWords(words []word, maxChars int) [][]word {
+	if lineLength(words) <= maxChars {
+		return [][]word{words}
+	}
+	var lines [][]word
+	start := 0
+	for _, end := range bestBreaks(words, maxChars) {
+		lines = append(lines, words[start:end])
+		start = end
+	}
+	return lines
+}
+
+// layout is the best way to lay out the words from some index on, given
+// where its first line ends.
+type layout struct {
+	lines int
+	cost  int
+	next  int // end of the second line, or 0 if there is none
+}
+
+// bestBreaks returns the ends of the lines in the split of words into the
+// fewest lines of at most maxChars characters, or of one over-long word, that
+// has the lowest layout cost. Lines longer than the line below them cost
+// twice as much as shorter ones, which favours a bottom-heavy pyramid. The
+// split is found by dynamic programming over the break positions: best[i][j]
+// holds the best layout of words[i:] whose first line is words[i:j].
+func bestBreaks(words []word, maxChars int) []int {
+	n := len(words)
+	// length(i, j) is the displayed length of words[i:j] joined by spaces.
+	prefix := make([]int, n+1)
+	for i, w := range words {
+		prefix[i+1] = prefix[i] + w.chars
+	}
+	length := func(i, j int) int {
+		return prefix[j] - prefix[i] + j - i - 1
+	}
+	fits := func(i, j int) bool {
+		return j-i == 1 || length(i, j) <= maxChars
+	}
+
+	best := make([][]layout, n+1)
+	for i := n - 1; i >= 0; i-- {
+		for j := i + 1; j <= n && fits(i, j); j++ {
+			l := layout{lines: 1}
+			if j < n {
+				l.lines = 0
+				for k := j + 1; k <= n && fits(j, k); k++ {
+					next := best[j][k-j-1]
+					cand := layout{lines: next.lines + 1, cost: next.cost + pairCost(length(i, j), length(j, k)), next: k}
+					if l.lines == 0 || cand.lines < l.lines || cand.lines == l.lines && cand.cost < l.cost {
+						l = cand
+					}
+				}
+			}
+			best[i] = append(best[i], l)
+		}
+	}
+
+	first := 0
+	for j := range best[0] {
+		if l, f := best[0][j], best[0][first]; l.lines < f.lines || l.lines == f.lines && l.cost < f.cost {
+			first = j
+		}
+	}
+	ends := []int{first + 1}
+	for start, end := 0, first+1; end < n; {
+		next := best[start][end-start-1].next
+		start, end = end, next
+		ends = append(ends, end)
+	}
+	return ends
+}
+
+// pairCost scores the difference in length between a line and the line
+// below it.
+func pairCost(upper, lower int) int {
+	if d := upper - lower; d > 0 {
+		return 2 * d
+	}
+	return lower - upper
+}
@@ -64,6 +64,10 @@ func TestSubtitlePairs(t *testing.T) {
 			t.Errorf("TTML mismatch for %s (-want +got):\n%s", filepath.Base(ittPath), diff)
 		}
 
+		for _, f := range ttml.Validate(gotTTML) {
+			t.Errorf("TTML for %s failed schema validation: %s", filepath.Base(ittPath), f)
+		}
+
 		// Now VTT
 		gotVTT, err := vtt.ToVTT(doc)
 		if err != nil {
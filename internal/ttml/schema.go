@@ -0,0 +1,383 @@
+package ttml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+// TTML namespaces recognised by the schema validator.
+const (
+	NamespaceTTML      = "http://www.w3.org/ns/ttml"
+	NamespaceParameter = "http://www.w3.org/ns/ttml#parameter"
+	NamespaceStyling   = "http://www.w3.org/ns/ttml#styling"
+	NamespaceMetadata  = "http://www.w3.org/ns/ttml#metadata"
+	namespaceXML       = "http://www.w3.org/XML/1998/namespace"
+)
+
+// elementRule describes the content model of a TTML element.
+type elementRule struct {
+	children []string // TTML elements allowed as children
+	attrs    []string // unqualified attributes allowed on the element
+	text     bool     // whether non-whitespace text content is allowed
+	styled   bool     // whether tts:* attributes are allowed
+	content  bool     // whether ttm:agent and ttm:role are allowed
+}
+
+var (
+	timingAttrs  = []string{"begin", "end", "dur", "timeContainer"}
+	contentAttrs = append([]string{"style", "region", "condition", "animate"}, timingAttrs...)
+)
+
+// elementRules is a reduced form of the TTML2 content model, restricted to the
+// vocabulary used by timed text profiles such as IMSC.
+var elementRules = map[string]elementRule{
+	"tt":       {children: []string{"head", "body"}, styled: true},
+	"head":     {children: []string{"metadata", "styling", "layout", "animation", "resources"}},
+	"styling":  {children: []string{"metadata", "initial", "style"}},
+	"initial":  {children: []string{"metadata"}, attrs: []string{"condition"}, styled: true},
+	"style":    {children: []string{"metadata"}, attrs: []string{"style", "condition"}, styled: true},
+	"layout":   {children: []string{"metadata", "region"}},
+	"region":   {children: []string{"metadata", "style", "set", "animate"}, attrs: append([]string{"style", "condition", "animate"}, timingAttrs...), styled: true},
+	"body":     {children: []string{"metadata", "set", "animate", "div"}, attrs: contentAttrs, styled: true, content: true},
+	"div":      {children: []string{"metadata", "set", "animate", "region", "div", "p"}, attrs: contentAttrs, styled: true, content: true},
+	"p":        {children: []string{"metadata", "set", "animate", "span", "br"}, attrs: contentAttrs, styled: true, content: true, text: true},
+	"span":     {children: []string{"metadata", "set", "animate", "span", "br"}, attrs: contentAttrs, styled: true, content: true, text: true},
+	"br":       {children: []string{"metadata", "set", "animate"}, attrs: []string{"style", "condition", "animate"}, styled: true, content: true},
+	"set":      {children: []string{"metadata"}, attrs: []string{"begin", "end", "dur", "condition", "fill", "repeatCount"}, styled: true},
+	"animate":  {children: []string{"metadata"}, attrs: []string{"begin", "end", "dur", "condition", "fill", "repeatCount", "calcMode", "keySplines", "keyTimes"}, styled: true},
+	"metadata": {content: true},
+}
+
+// stylingAttrs lists the TTML2 styling attributes.
+var stylingAttrs = []string{
+	"backgroundClip", "backgroundColor", "backgroundExtent", "backgroundImage",
+	"backgroundOrigin", "backgroundPosition", "backgroundRepeat", "border",
+	"bpd", "color", "direction", "disparity", "display", "displayAlign",
+	"extent", "fontFamily", "fontKerning", "fontSelectionStrategy", "fontShear",
+	"fontSize", "fontStyle", "fontVariant", "fontWeight", "ipd", "letterSpacing",
+	"lineHeight", "lineShear", "luminanceGain", "opacity", "origin", "overflow",
+	"padding", "position", "ruby", "rubyAlign", "rubyPosition", "rubyReserve",
+	"shear", "showBackground", "textAlign", "textCombine", "textDecoration",
+	"textEmphasis", "textOrientation", "textOutline", "textShadow",
+	"unicodeBidi", "visibility", "wrapOption", "writingMode", "zIndex",
+}
+
+// parameterAttrs lists the TTML2 parameter attributes, allowed on <tt> only.
+var parameterAttrs = []string{
+	"cellResolution", "clockMode", "contentProfileCombination", "contentProfiles",
+	"displayAspectRatio", "dropMode", "frameRate", "frameRateMultiplier",
+	"inferProcessorProfileMethod", "inferProcessorProfileSource", "markerMode",
+	"mediaDuration", "mediaOffset", "permitFeatureNarrowing", "permitFeatureWidening",
+	"pixelAspectRatio", "processorProfileCombination", "processorProfiles",
+	"profile", "subFrameRate", "tickRate", "timeBase", "validation", "validationAction",
+	"version",
+}
+
+var (
+	clockTimeRe  = regexp.MustCompile(`^(\d{2,}):(\d{2}):(\d{2})(?:(\.\d+)|:(\d{2,})(?:\.(\d+))?)?$`)
+	offsetTimeRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)(h|m|s|ms|f|t)$`)
+	lengthRe     = regexp.MustCompile(`^[+-]?\d+(?:\.\d+)?(?:px|%)$`)
+)
+
+// reference is an IDREF waiting to be resolved once all IDs are known.
+type reference struct {
+	finding errs.Finding
+	kind    string // "style", "region" or "agent"
+	id      string
+}
+
+// schemaValidator holds the state of a single Validate run.
+type schemaValidator struct {
+	findings []errs.Finding
+	ids      map[string]string // xml:id -> element local name
+	refs     []reference
+}
+
+// Validate checks a TTML document against a reduced TTML2/IMSC schema. It
+// reports element nesting and namespace errors, attributes that are not
+// allowed on their element, malformed time expressions and lengths, duplicate
+// IDs and style, region and agent references that do not resolve. Findings are
+// returned in document order; an empty result means the document is valid.
+//
+// Unlike ValidateTTML, which only guards the converter against emitting
+// malformed XML, Validate is meant for arbitrary TTML files.
+func Validate(ttmlStr string) []errs.Finding {
+	v := &schemaValidator{ids: make(map[string]string)}
+	v.run([]byte(ttmlStr))
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		a, b := v.findings[i], v.findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.findings
+}
+
+func (v *schemaValidator) run(data []byte) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	columns := errs.NewColumns(data)
+	type frame struct {
+		name    xml.Name
+		rule    elementRule
+		foreign bool // inside <metadata> or a foreign element; not validated
+	}
+	var stack []frame
+	seenRoot := false
+
+	for {
+		line, _ := dec.InputPos()
+		col := columns.At(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, _ = dec.InputPos()
+			col = columns.At(dec.InputOffset())
+			v.findings = append(v.findings, errs.Finding{Line: line, Column: col, Message: fmt.Sprintf("malformed XML: %v", err)})
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			at := errs.Finding{Line: line, Column: col, Element: t.Name.Local}
+			var parent *frame
+			if len(stack) > 0 {
+				parent = &stack[len(stack)-1]
+			}
+
+			if parent != nil && parent.foreign {
+				stack = append(stack, frame{name: t.Name, foreign: true})
+				v.checkIDs(at, t.Attr)
+				continue
+			}
+
+			if parent == nil {
+				if seenRoot {
+					v.report(at, "", "multiple root elements")
+				}
+				seenRoot = true
+				if t.Name.Space != NamespaceTTML || t.Name.Local != "tt" {
+					v.report(at, "", fmt.Sprintf("root element must be <tt> in namespace %s", NamespaceTTML))
+				}
+			}
+
+			if t.Name.Space != NamespaceTTML {
+				if parent != nil && parent.name.Local != "metadata" {
+					v.report(at, "", fmt.Sprintf("element in namespace %q is only allowed inside <metadata>", t.Name.Space))
+				}
+				stack = append(stack, frame{name: t.Name, foreign: true})
+				v.checkIDs(at, t.Attr)
+				continue
+			}
+
+			rule, known := elementRules[t.Name.Local]
+			if !known {
+				v.report(at, "", "unknown TTML element")
+			}
+			if parent != nil && !slices.Contains(parent.rule.children, t.Name.Local) {
+				v.report(at, "", fmt.Sprintf("<%s> is not allowed inside <%s>", t.Name.Local, parent.name.Local))
+			}
+			if t.Name.Local == "tt" {
+				v.checkRoot(at, t.Attr)
+			}
+			v.checkAttrs(at, rule, t.Attr)
+			stack = append(stack, frame{name: t.Name, rule: rule, foreign: !known || t.Name.Local == "metadata"})
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			if len(stack) == 0 || stack[len(stack)-1].foreign || stack[len(stack)-1].rule.text {
+				continue
+			}
+			if len(bytes.TrimSpace(t)) > 0 {
+				top := stack[len(stack)-1]
+				v.report(errs.Finding{Line: line, Column: col, Element: top.name.Local}, "", "text content is not allowed here")
+			}
+		}
+	}
+
+	if !seenRoot {
+		v.findings = append(v.findings, errs.Finding{Line: 1, Column: 1, Message: "document has no root element"})
+	}
+	v.resolveReferences()
+}
+
+// report records a finding at the location of at.
+func (v *schemaValidator) report(at errs.Finding, attr, msg string) {
+	at.Attr = attr
+	at.Message = msg
+	v.findings = append(v.findings, at)
+}
+
+// checkRoot applies the rules specific to the <tt> element.
+func (v *schemaValidator) checkRoot(at errs.Finding, attrs []xml.Attr) {
+	hasLang := false
+	for _, a := range attrs {
+		if a.Name.Space == namespaceXML && a.Name.Local == "lang" {
+			hasLang = true
+		}
+		if a.Name.Space == NamespaceParameter && a.Name.Local == "timeBase" {
+			switch a.Value {
+			case "media", "smpte", "clock":
+			default:
+				v.report(at, "ttp:timeBase", fmt.Sprintf("invalid time base %q", a.Value))
+			}
+		}
+	}
+	if !hasLang {
+		v.report(at, "", "missing required xml:lang attribute")
+	}
+}
+
+// checkAttrs validates the attributes of a TTML element.
+func (v *schemaValidator) checkAttrs(at errs.Finding, rule elementRule, attrs []xml.Attr) {
+	v.checkIDs(at, attrs)
+	for _, a := range attrs {
+		switch a.Name.Space {
+		case "":
+			if a.Name.Local == "xmlns" {
+				continue
+			}
+			if !slices.Contains(rule.attrs, a.Name.Local) {
+				v.report(at, a.Name.Local, "attribute is not allowed on this element")
+				continue
+			}
+			v.checkValue(at, a)
+		case "xmlns", namespaceXML:
+			// Namespace declarations and xml:id/lang/space/base are allowed everywhere.
+		case NamespaceStyling:
+			name := "tts:" + a.Name.Local
+			if !slices.Contains(stylingAttrs, a.Name.Local) {
+				v.report(at, name, "unknown styling attribute")
+			} else if !rule.styled {
+				v.report(at, name, "styling attributes are not allowed on this element")
+			} else if a.Name.Local == "origin" || a.Name.Local == "extent" {
+				v.checkLengths(at, name, a.Value)
+			}
+		case NamespaceParameter:
+			name := "ttp:" + a.Name.Local
+			if !slices.Contains(parameterAttrs, a.Name.Local) {
+				v.report(at, name, "unknown parameter attribute")
+			} else if at.Element != "tt" {
+				v.report(at, name, "parameter attributes are only allowed on <tt>")
+			}
+		case NamespaceMetadata:
+			name := "ttm:" + a.Name.Local
+			switch {
+			case a.Name.Local != "agent" && a.Name.Local != "role":
+				v.report(at, name, "unknown metadata attribute")
+			case !rule.content:
+				v.report(at, name, "metadata attributes are not allowed on this element")
+			case a.Name.Local == "agent":
+				for _, id := range strings.Fields(a.Value) {
+					v.refs = append(v.refs, reference{finding: withAttr(at, name), kind: "agent", id: id})
+				}
+			}
+		case NamespaceTTML:
+			v.report(at, a.Name.Local, "attributes must not be in the TTML namespace")
+		default:
+			// The decoder leaves undeclared prefixes untranslated.
+			if !strings.Contains(a.Name.Space, ":") {
+				v.report(at, a.Name.Space+":"+a.Name.Local, fmt.Sprintf("undeclared namespace prefix %q", a.Name.Space))
+			}
+		}
+	}
+}
+
+// checkIDs records xml:id values and reports duplicates.
+func (v *schemaValidator) checkIDs(at errs.Finding, attrs []xml.Attr) {
+	for _, a := range attrs {
+		if a.Name.Space != namespaceXML || a.Name.Local != "id" {
+			continue
+		}
+		if _, dup := v.ids[a.Value]; dup {
+			v.report(at, "xml:id", fmt.Sprintf("duplicate ID %q", a.Value))
+			continue
+		}
+		v.ids[a.Value] = at.Element
+	}
+}
+
+// checkValue validates the value of an unqualified attribute.
+func (v *schemaValidator) checkValue(at errs.Finding, a xml.Attr) {
+	switch a.Name.Local {
+	case "begin", "end", "dur":
+		if !validTimeExpression(a.Value) {
+			v.report(at, a.Name.Local, fmt.Sprintf("invalid time expression %q", a.Value))
+		}
+	case "timeContainer":
+		if a.Value != "par" && a.Value != "seq" {
+			v.report(at, a.Name.Local, fmt.Sprintf("invalid time container %q", a.Value))
+		}
+	case "style", "region":
+		for _, id := range strings.Fields(a.Value) {
+			v.refs = append(v.refs, reference{finding: withAttr(at, a.Name.Local), kind: a.Name.Local, id: id})
+		}
+	}
+}
+
+// checkLengths validates a pair of lengths as used by tts:origin and tts:extent.
+// IMSC only allows pixel and percentage units for these attributes.
+func (v *schemaValidator) checkLengths(at errs.Finding, name, value string) {
+	if value == "auto" && strings.HasSuffix(name, "extent") {
+		return
+	}
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		v.report(at, name, fmt.Sprintf("expected two lengths, got %q", value))
+		return
+	}
+	for _, p := range parts {
+		if !lengthRe.MatchString(p) {
+			v.report(at, name, fmt.Sprintf("invalid length %q, expected px or %%", p))
+		}
+	}
+}
+
+// resolveReferences reports IDREFs that do not point to an element of the
+// expected kind.
+func (v *schemaValidator) resolveReferences() {
+	want := map[string]string{"style": "style", "region": "region", "agent": "agent"}
+	for _, ref := range v.refs {
+		element, ok := v.ids[ref.id]
+		switch {
+		case !ok:
+			v.report(ref.finding, ref.finding.Attr, fmt.Sprintf("unknown %s %q", ref.kind, ref.id))
+		case element != want[ref.kind]:
+			v.report(ref.finding, ref.finding.Attr, fmt.Sprintf("%q refers to a <%s>, expected a <%s>", ref.id, element, want[ref.kind]))
+		}
+	}
+}
+
+// validTimeExpression reports whether s is a TTML clock-time or offset-time.
+func validTimeExpression(s string) bool {
+	if offsetTimeRe.MatchString(s) {
+		return true
+	}
+	m := clockTimeRe.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.Atoi(m[3])
+	return minutes < 60 && seconds < 60
+}
+
+func withAttr(f errs.Finding, attr string) errs.Finding {
+	f.Attr = attr
+	return f
+}
@@ -8,19 +8,25 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/mediafellows/ittconv/internal/errs"
 	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/units"
 )
 
 // ToTTML converts an ITTDocument to a standard TTML formatted string.
 func ToTTML(doc *parser.ITTDocument) (string, error) {
 	// Create a new structure that can be easily marshaled to XML
 	type ttP struct {
-		XMLName xml.Name `xml:"p"`
-		Begin   string   `xml:"begin,attr"`
-		End     string   `xml:"end,attr"`
-		Content string   `xml:",innerxml"`
-		Style   string   `xml:"style,attr,omitempty"`
-		Region  string   `xml:"region,attr,omitempty"`
+		XMLName   xml.Name `xml:"p"`
+		Begin     string   `xml:"begin,attr"`
+		End       string   `xml:"end,attr"`
+		Content   string   `xml:",innerxml"`
+		Style     string   `xml:"style,attr,omitempty"`
+		Region    string   `xml:"region,attr,omitempty"`
+		Direction string   `xml:"tts:direction,attr,omitempty"`
+		Lang      string   `xml:"xml:lang,attr,omitempty"`
+		Agent     string   `xml:"ttm:agent,attr,omitempty"`
+		Role      string   `xml:"ttm:role,attr,omitempty"`
 	}
 
 	type ttDiv struct {
@@ -35,13 +41,19 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 	}
 
 	type ttStyle struct {
-		XMLName    xml.Name `xml:"style"`
-		ID         string   `xml:"xml:id,attr"`
-		Color      string   `xml:"tts:color,attr,omitempty"`
-		FontFamily string   `xml:"tts:fontFamily,attr,omitempty"`
-		FontSize   string   `xml:"tts:fontSize,attr,omitempty"`
-		FontStyle  string   `xml:"tts:fontStyle,attr,omitempty"`
-		FontWeight string   `xml:"tts:fontWeight,attr,omitempty"`
+		XMLName         xml.Name `xml:"style"`
+		ID              string   `xml:"xml:id,attr"`
+		BackgroundColor string   `xml:"tts:backgroundColor,attr,omitempty"`
+		Color           string   `xml:"tts:color,attr,omitempty"`
+		Direction       string   `xml:"tts:direction,attr,omitempty"`
+		FontFamily      string   `xml:"tts:fontFamily,attr,omitempty"`
+		FontSize        string   `xml:"tts:fontSize,attr,omitempty"`
+		FontStyle       string   `xml:"tts:fontStyle,attr,omitempty"`
+		FontWeight      string   `xml:"tts:fontWeight,attr,omitempty"`
+		Ruby            string   `xml:"tts:ruby,attr,omitempty"`
+		TextCombine     string   `xml:"tts:textCombine,attr,omitempty"`
+		TextDecoration  string   `xml:"tts:textDecoration,attr,omitempty"`
+		UnicodeBidi     string   `xml:"tts:unicodeBidi,attr,omitempty"`
 	}
 
 	type ttStyling struct {
@@ -52,10 +64,12 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 	type ttRegion struct {
 		XMLName      xml.Name `xml:"region"`
 		ID           string   `xml:"xml:id,attr"`
-		Origin       string   `xml:"origin,attr,omitempty"`
-		Extent       string   `xml:"extent,attr,omitempty"`
-		DisplayAlign string   `xml:"displayAlign,attr,omitempty"`
-		TextAlign    string   `xml:"textAlign,attr,omitempty"`
+		Origin       string   `xml:"tts:origin,attr,omitempty"`
+		Extent       string   `xml:"tts:extent,attr,omitempty"`
+		DisplayAlign string   `xml:"tts:displayAlign,attr,omitempty"`
+		TextAlign    string   `xml:"tts:textAlign,attr,omitempty"`
+		WritingMode  string   `xml:"tts:writingMode,attr,omitempty"`
+		Direction    string   `xml:"tts:direction,attr,omitempty"`
 	}
 
 	type ttLayout struct {
@@ -63,21 +77,57 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 		Regions []ttRegion `xml:"region"`
 	}
 
+	type ttAgentName struct {
+		XMLName xml.Name `xml:"ttm:name"`
+		Type    string   `xml:"type,attr"`
+		Name    string   `xml:",chardata"`
+	}
+
+	type ttActor struct {
+		XMLName xml.Name `xml:"ttm:actor"`
+		Agent   string   `xml:"agent,attr"`
+	}
+
+	type ttAgent struct {
+		XMLName xml.Name      `xml:"ttm:agent"`
+		ID      string        `xml:"xml:id,attr"`
+		Type    string        `xml:"type,attr"`
+		Names   []ttAgentName `xml:"ttm:name"`
+		Actor   *ttActor      `xml:"ttm:actor"`
+	}
+
+	type ttMetadata struct {
+		XMLName   xml.Name  `xml:"metadata"`
+		Agent     string    `xml:"ttm:agent,attr,omitempty"`
+		Role      string    `xml:"ttm:role,attr,omitempty"`
+		Title     string    `xml:"ttm:title,omitempty"`
+		Desc      string    `xml:"ttm:desc,omitempty"`
+		Copyright string    `xml:"ttm:copyright,omitempty"`
+		Agents    []ttAgent `xml:"ttm:agent"`
+		Other     string    `xml:",innerxml"`
+	}
+
 	type ttHead struct {
-		XMLName xml.Name  `xml:"head"`
-		Styling ttStyling `xml:"styling"`
-		Layout  ttLayout  `xml:"layout"`
+		XMLName  xml.Name    `xml:"head"`
+		Metadata *ttMetadata `xml:"metadata"`
+		Styling  ttStyling   `xml:"styling"`
+		Layout   ttLayout    `xml:"layout"`
 	}
 
 	type ttRoot struct {
-		XMLName  xml.Name `xml:"tt"`
-		Xmlns    string   `xml:"xmlns,attr"`
-		XmlnsTTP string   `xml:"xmlns:ttp,attr"`
-		XmlnsTTS string   `xml:"xmlns:tts,attr"`
-		TimeBase string   `xml:"ttp:timeBase,attr"`
-		Lang     string   `xml:"xml:lang,attr"`
-		Head     ttHead   `xml:"head"`
-		Body     ttBody   `xml:"body"`
+		XMLName  xml.Name   `xml:"tt"`
+		Xmlns    string     `xml:"xmlns,attr"`
+		XmlnsTTP string     `xml:"xmlns:ttp,attr"`
+		XmlnsTTS string     `xml:"xmlns:tts,attr"`
+		XmlnsTTM string     `xml:"xmlns:ttm,attr,omitempty"`
+		XmlnsAny []xml.Attr `xml:",any,attr"`
+		TimeBase string     `xml:"ttp:timeBase,attr"`
+		Lang     string     `xml:"xml:lang,attr"`
+		Extent   string     `xml:"tts:extent,attr,omitempty"`
+		Cells    string     `xml:"ttp:cellResolution,attr,omitempty"`
+		PAR      string     `xml:"ttp:pixelAspectRatio,attr,omitempty"`
+		Head     ttHead     `xml:"head"`
+		Body     ttBody     `xml:"body"`
 	}
 
 	// Convert parser.ITTDocument to the marshalable ttRoot structure
@@ -87,6 +137,43 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 		XmlnsTTS: "http://www.w3.org/ns/ttml#styling",
 		TimeBase: "media", // As per GUIDE.md
 		Lang:     doc.Lang,
+		Extent:   doc.Extent,
+		Cells:    doc.CellResolution,
+		PAR:      doc.PixelAspectRatio,
+	}
+
+	if md := doc.Metadata; !md.IsZero() {
+		metadata := &ttMetadata{
+			Agent:     md.Agent,
+			Role:      md.Role,
+			Title:     md.Title,
+			Desc:      md.Desc,
+			Copyright: md.Copyright,
+			Other:     strings.Join(md.Other, ""),
+		}
+		for _, agent := range md.Agents {
+			a := ttAgent{ID: agent.ID, Type: agent.Type}
+			for _, name := range agent.Names {
+				a.Names = append(a.Names, ttAgentName{Type: name.Type, Name: name.Name})
+			}
+			if agent.Actor != "" {
+				a.Actor = &ttActor{Agent: agent.Actor}
+			}
+			metadata.Agents = append(metadata.Agents, a)
+		}
+		outputDoc.Head.Metadata = metadata
+		outputDoc.XmlnsTTM = NamespaceMetadata
+		// Other metadata may use the prefixes declared in the source.
+		if len(md.Other) > 0 {
+			prefixes := make([]string, 0, len(md.Namespaces))
+			for prefix := range md.Namespaces {
+				prefixes = append(prefixes, prefix)
+			}
+			sort.Strings(prefixes)
+			for _, prefix := range prefixes {
+				outputDoc.XmlnsAny = append(outputDoc.XmlnsAny, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: md.Namespaces[prefix]})
+			}
+		}
 	}
 
 	// Styles (deterministic order by ID)
@@ -98,12 +185,18 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 	for _, id := range styleIDs {
 		style := doc.Styles[id]
 		outputDoc.Head.Styling.Styles = append(outputDoc.Head.Styling.Styles, ttStyle{
-			ID:         style.ID,
-			Color:      style.Color,
-			FontFamily: style.FontFamily,
-			FontSize:   style.FontSize,
-			FontStyle:  style.FontStyle,
-			FontWeight: style.FontWeight,
+			ID:              style.ID,
+			BackgroundColor: style.BackgroundColor,
+			Color:           style.Color,
+			Direction:       style.Direction,
+			FontFamily:      style.FontFamily,
+			FontSize:        percentFontSize(style.FontSize, doc.Units),
+			FontStyle:       style.FontStyle,
+			FontWeight:      style.FontWeight,
+			Ruby:            style.Ruby,
+			TextCombine:     style.TextCombine,
+			TextDecoration:  style.TextDecoration,
+			UnicodeBidi:     style.UnicodeBidi,
 		})
 	}
 
@@ -117,10 +210,12 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 		region := doc.Regions[id]
 		outputDoc.Head.Layout.Regions = append(outputDoc.Head.Layout.Regions, ttRegion{
 			ID:           region.ID,
-			Origin:       region.Origin,
-			Extent:       region.Extent,
+			Origin:       percentLengths(region.Origin, doc.Units),
+			Extent:       percentLengths(region.Extent, doc.Units),
 			DisplayAlign: region.DisplayAlign,
 			TextAlign:    region.TextAlign,
+			WritingMode:  region.WritingMode,
+			Direction:    region.Direction,
 		})
 	}
 
@@ -135,14 +230,27 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		// Right-to-left text is marked on each paragraph, including text
+		// that is only right to left by the document language.
+		var direction string
+		if dir := doc.Direction(cue); dir == "rtl" || cue.Direction != "" {
+			direction = dir
+		}
 		cues = append(cues, ttP{
-			Begin:   begin,
-			End:     end,
-			Content: cue.Content,
-			Region:  cue.RegionID,
-			Style:   strings.Join(cue.StyleIDs, " "),
+			Begin:     begin,
+			End:       end,
+			Content:   cue.Content,
+			Region:    cue.RegionID,
+			Style:     strings.Join(cue.StyleIDs, " "),
+			Direction: direction,
+			Lang:      cue.Lang,
+			Agent:     strings.Join(cue.Agents, " "),
+			Role:      cue.Role,
 		})
 	}
+	if doc.HasSpeakers {
+		outputDoc.XmlnsTTM = NamespaceMetadata
+	}
 	outputDoc.Body.Divs = append(outputDoc.Body.Divs, ttDiv{Ps: cues})
 
 	var buf bytes.Buffer
@@ -156,12 +264,50 @@ func ToTTML(doc *parser.ITTDocument) (string, error) {
 
 	// Perform a lightweight validation to ensure we didn't generate malformed XML.
 	if err := ValidateTTML(buf.String()); err != nil {
-		return "", fmt.Errorf("generated TTML failed validation: %w", err)
+		return "", errs.New(errs.ErrValidation, "generated TTML failed validation: %w", err)
 	}
 
 	return buf.String(), nil
 }
 
+// percentLengths converts a pair of lengths in cells or pixels to
+// percentages of the root container, which every TTML profile accepts.
+// Lengths that cannot be converted are returned unchanged.
+func percentLengths(s string, root units.Root) string {
+	lengths, err := units.ParseLengths(s)
+	if err != nil {
+		return s
+	}
+	percent, err := root.Percentages(lengths)
+	if err != nil {
+		return s
+	}
+	return units.FormatPercentages(percent)
+}
+
+// percentFontSize converts a font size in cells or pixels, or a pair of them
+// for width and height, to percentages of the default font size, which is
+// one cell high. Sizes that cannot be converted are returned unchanged.
+func percentFontSize(s string, root units.Root) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s
+	}
+	out := make([]string, len(fields))
+	for i, f := range fields {
+		l, err := units.ParseLength(f)
+		if err != nil {
+			return s
+		}
+		v, err := root.FontSize(l)
+		if err != nil {
+			return s
+		}
+		out[i] = units.FormatPercent(v)
+	}
+	return strings.Join(out, " ")
+}
+
 // formatTTMLTimestamp converts a big.Rat (in milliseconds) to a TTML time string (HH:MM:SS.ms).
 func formatTTMLTimestamp(ms *big.Rat) (string, error) {
 	if ms == nil {
@@ -2,6 +2,7 @@ package ttml
 
 import (
 	"io/ioutil"
+	"math/big"
 	"strings"
 	"testing"
 
@@ -50,3 +51,223 @@ func TestToTTML(t *testing.T) {
 		t.Error("Expected tt root element with ttml namespace.")
 	}
 }
+
+func TestToTTML_Units(t *testing.T) {
+	doc, err := parser.ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:frameRate="25" tts:extent="1920px 1080px" ttp:cellResolution="40 20">
+<head><styling>
+<style xml:id="big" tts:fontSize="81px"/>
+<style xml:id="wide" tts:fontSize="1c 2c"/>
+</styling><layout>
+<region xml:id="px" tts:origin="192px 864px" tts:extent="1536px 108px"/>
+<region xml:id="cells" tts:origin="4c 2c" tts:extent="32c 3c"/>
+</layout></head>
+<body><div><p begin="00:00:01:00" end="00:00:02:00" region="px">Text</p></div></body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+
+	ttmlOutput, err := ToTTML(doc)
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	for _, want := range []string{
+		`tts:extent="1920px 1080px" ttp:cellResolution="40 20">`,
+		`<region xml:id="px" tts:origin="10% 80%" tts:extent="80% 10%">`,
+		`<region xml:id="cells" tts:origin="10% 10%" tts:extent="80% 15%">`,
+		`<style xml:id="big" tts:fontSize="150%">`,
+		`<style xml:id="wide" tts:fontSize="100% 200%">`,
+	} {
+		if !strings.Contains(ttmlOutput, want) {
+			t.Errorf("Expected %s in output:\n%s", want, ttmlOutput)
+		}
+	}
+}
+
+func TestToTTML_Direction(t *testing.T) {
+	doc, err := parser.ParseITT(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:frameRate="25" xml:lang="he">
+<head><styling><style xml:id="latin" tts:direction="ltr" tts:unicodeBidi="embed"/></styling></head>
+<body><div>
+<p begin="00:00:01:00" end="00:00:02:00">שלום</p>
+<p begin="00:00:03:00" end="00:00:04:00" style="latin">Hello</p>
+</div></body>
+</tt>`)
+	if err != nil {
+		t.Fatalf("ParseITT failed: %v", err)
+	}
+
+	ttmlOutput, err := ToTTML(doc)
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	for _, want := range []string{
+		`<style xml:id="latin" tts:direction="ltr" tts:unicodeBidi="embed">`,
+		`<p begin="00:00:01.000" end="00:00:02.000" tts:direction="rtl">`,
+		`<p begin="00:00:03.000" end="00:00:04.000" style="latin" tts:direction="ltr">`,
+	} {
+		if !strings.Contains(ttmlOutput, want) {
+			t.Errorf("Expected %s in output:\n%s", want, ttmlOutput)
+		}
+	}
+}
+
+func TestToTTML_Metadata(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Lang: "en",
+		Metadata: parser.Metadata{
+			Title: "Pilot & Friends",
+			Role:  "caption",
+			Agents: []parser.Agent{
+				{ID: "alice", Type: "character", Names: []parser.AgentName{{Type: "alias", Name: "Alice"}}, Actor: "jane"},
+				{ID: "jane", Type: "person", Names: []parser.AgentName{{Type: "full", Name: "Jane Doe"}}},
+			},
+			Other:      []string{`<ebuttm:documentEbuttVersion>v1.0</ebuttm:documentEbuttVersion>`},
+			Namespaces: map[string]string{"ebuttm": "urn:ebu:tt:metadata"},
+		},
+	}
+
+	ttmlOutput, err := ToTTML(doc)
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	want := `  <head>
+    <metadata ttm:role="caption">
+      <ttm:title>Pilot &amp; Friends</ttm:title>
+      <ttm:agent xml:id="alice" type="character">
+        <ttm:name type="alias">Alice</ttm:name>
+        <ttm:actor agent="jane"></ttm:actor>
+      </ttm:agent>
+      <ttm:agent xml:id="jane" type="person">
+        <ttm:name type="full">Jane Doe</ttm:name>
+      </ttm:agent><ebuttm:documentEbuttVersion>v1.0</ebuttm:documentEbuttVersion>
+    </metadata>
+    <styling></styling>`
+	if !strings.Contains(ttmlOutput, want) {
+		t.Errorf("Expected metadata in output:\n%s", ttmlOutput)
+	}
+	if !strings.Contains(ttmlOutput, `xmlns:ttm="http://www.w3.org/ns/ttml#metadata" xmlns:ebuttm="urn:ebu:tt:metadata"`) {
+		t.Errorf("Expected the metadata namespaces on the root element:\n%s", ttmlOutput)
+	}
+	if findings := Validate(ttmlOutput); len(findings) > 0 {
+		t.Errorf("Expected valid TTML, got %v", findings)
+	}
+
+	ttmlOutput, err = ToTTML(&parser.ITTDocument{Lang: "en"})
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	if strings.Contains(ttmlOutput, "metadata") {
+		t.Errorf("Expected no metadata without any:\n%s", ttmlOutput)
+	}
+}
+
+func TestToTTML_Speakers(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Lang: "en",
+		Metadata: parser.Metadata{
+			Agents: []parser.Agent{{ID: "alice", Type: "character"}, {ID: "bob", Type: "character"}},
+		},
+		Cues: []parser.Cue{
+			{Begin: big.NewRat(1000, 1), End: big.NewRat(2000, 1), Agents: []string{"alice", "bob"}, Role: "dialog", Content: "Hi"},
+		},
+		HasSpeakers: true,
+	}
+
+	ttmlOutput, err := ToTTML(doc)
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	for _, want := range []string{
+		`xmlns:ttm="http://www.w3.org/ns/ttml#metadata"`,
+		`<p begin="00:00:01.000" end="00:00:02.000" ttm:agent="alice bob" ttm:role="dialog">Hi</p>`,
+	} {
+		if !strings.Contains(ttmlOutput, want) {
+			t.Errorf("Expected %s in output:\n%s", want, ttmlOutput)
+		}
+	}
+	if findings := Validate(ttmlOutput); len(findings) > 0 {
+		t.Errorf("Expected valid TTML, got %v", findings)
+	}
+
+	// A role on a span alone needs the namespace too.
+	doc = &parser.ITTDocument{
+		Cues:        []parser.Cue{{Begin: big.NewRat(1000, 1), End: big.NewRat(2000, 1), Content: `<span ttm:role="sound">[door]</span>`}},
+		HasSpeakers: true,
+	}
+	ttmlOutput, err = ToTTML(doc)
+	if err != nil {
+		t.Fatalf("ToTTML failed: %v", err)
+	}
+	if !strings.Contains(ttmlOutput, `xmlns:ttm="http://www.w3.org/ns/ttml#metadata"`) {
+		t.Errorf("Expected the ttm namespace in output:\n%s", ttmlOutput)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const head = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xml:lang="en">`
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "Valid",
+			input: head + `<head><styling><style xml:id="s1" tts:color="white"/></styling><layout><region xml:id="r1" tts:origin="10% 80%" tts:extent="80% 20%"/></layout></head><body><div><p begin="00:00:01.000" end="2s" style="s1" region="r1">Hi<br/><span>there</span></p></div></body></tt>`,
+		},
+		{
+			name:  "Nesting",
+			input: head + `<body><p begin="00:00:01.000" end="00:00:02.000">Hi</p></body></tt>`,
+			want:  []string{"1:153: <p>: <p> is not allowed inside <body>"},
+		},
+		{
+			name:  "AttributesAndNamespaces",
+			input: head + `<head><layout><region xml:id="r1" origin="0% 0%" tts:extent="10c 2c"/></layout></head><body ttp:frameRate="24"><div/></body></tt>`,
+			want: []string{
+				"1:161: <region> origin: attribute is not allowed on this element",
+				"1:161: <region> tts:extent: invalid length \"10c\", expected px or %",
+				"1:161: <region> tts:extent: invalid length \"2c\", expected px or %",
+				"1:233: <body> ttp:frameRate: parameter attributes are only allowed on <tt>",
+			},
+		},
+		{
+			name:  "TimeExpressions",
+			input: head + `<body><div><p begin="00:61:00.000" end="5 s">Hi</p></div></body></tt>`,
+			want: []string{
+				"1:158: <p> begin: invalid time expression \"00:61:00.000\"",
+				"1:158: <p> end: invalid time expression \"5 s\"",
+			},
+		},
+		{
+			name:  "IDs",
+			input: head + `<head><styling><style xml:id="a"/><style xml:id="a"/></styling></head><body style="a"><div region="a"><p style="b">Hi</p></div></body></tt>`,
+			want: []string{
+				"1:181: <style> xml:id: duplicate ID \"a\"",
+				"1:233: <div> region: \"a\" refers to a <style>, expected a <region>",
+				"1:249: <p> style: unknown style \"b\"",
+			},
+		},
+		{
+			name:  "NonASCII",
+			input: head + `<body><div><p begin="1s" end="2s">Ça y est…</p><p begin="2s" end="3s" style="b">Fin</p></div></body></tt>`,
+			want:  []string{"1:194: <p> style: unknown style \"b\""},
+		},
+		{
+			name:  "Malformed",
+			input: head + `<body></tt>`,
+			want:  []string{"1:158: malformed XML: XML syntax error on line 1: element <body> closed by </tt>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Validate(tt.input) {
+				got = append(got, f.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Validate findings mismatch.\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
@@ -2,7 +2,8 @@ package ttml
 
 import (
 	"encoding/xml"
-	"fmt"
+
+	"github.com/mediafellows/ittconv/internal/errs"
 )
 
 // ValidateTTML performs a lightweight validation of a TTML document.
@@ -28,15 +29,15 @@ func ValidateTTML(ttmlStr string) error {
 
 	var r root
 	if err := xml.Unmarshal([]byte(ttmlStr), &r); err != nil {
-		return fmt.Errorf("invalid TTML XML: %w", err)
+		return errs.New(errs.ErrMalformedXML, "invalid TTML XML: %w", err)
 	}
 
 	if r.XMLName.Local != "tt" {
-		return fmt.Errorf("root element is <%s>, expected <tt>", r.XMLName.Local)
+		return errs.New(errs.ErrValidation, "root element is <%s>, expected <tt>", r.XMLName.Local)
 	}
 
 	if r.Body == nil {
-		return fmt.Errorf("TTML document is missing required <body> element")
+		return errs.New(errs.ErrValidation, "TTML document is missing required <body> element")
 	}
 
 	return nil
@@ -0,0 +1,234 @@
+// Package units models the TTML length units — percentages, pixels and
+// cells — and converts between them using the parameters of the root <tt>
+// element.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+// Unit is the unit of a Length.
+type Unit int
+
+const (
+	// Percent is a percentage of the root container, or of the parent
+	// font size for font sizes.
+	Percent Unit = iota
+	// Pixel is a pixel of the root container extent.
+	Pixel
+	// Cell is a cell of the grid given by ttp:cellResolution.
+	Cell
+)
+
+// String returns the suffix written after a length in the unit.
+func (u Unit) String() string {
+	switch u {
+	case Percent:
+		return "%"
+	case Pixel:
+		return "px"
+	case Cell:
+		return "c"
+	}
+	return fmt.Sprintf("Unit(%d)", int(u))
+}
+
+// Length is a TTML length such as "80%", "1920px" or "1.5c".
+type Length struct {
+	Value float64
+	Unit  Unit
+}
+
+// String formats l as in TTML.
+func (l Length) String() string {
+	return strconv.FormatFloat(l.Value, 'f', -1, 64) + l.Unit.String()
+}
+
+// ParseLength parses a single TTML length.
+func ParseLength(s string) (Length, error) {
+	var unit Unit
+	var number string
+	switch {
+	case strings.HasSuffix(s, "%"):
+		unit, number = Percent, strings.TrimSuffix(s, "%")
+	case strings.HasSuffix(s, "px"):
+		unit, number = Pixel, strings.TrimSuffix(s, "px")
+	case strings.HasSuffix(s, "c"):
+		unit, number = Cell, strings.TrimSuffix(s, "c")
+	default:
+		return Length{}, errs.New(errs.ErrInvalidLength, "length %q has no unit, expected %%, px or c", s)
+	}
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil || v < 0 {
+		return Length{}, errs.New(errs.ErrInvalidLength, "invalid length %q", s)
+	}
+	return Length{Value: v, Unit: unit}, nil
+}
+
+// ParseLengths parses a pair of TTML lengths such as "10% 80%", as used by
+// tts:origin and tts:extent.
+func ParseLengths(s string) ([2]Length, error) {
+	var out [2]Length
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return out, errs.New(errs.ErrInvalidLength, "expected two lengths, got %q", s)
+	}
+	for i, p := range parts {
+		l, err := ParseLength(p)
+		if err != nil {
+			return out, err
+		}
+		out[i] = l
+	}
+	return out, nil
+}
+
+// Axis selects the horizontal or vertical dimension of the root container.
+type Axis int
+
+// Axes of the root container.
+const (
+	Horizontal Axis = iota
+	Vertical
+)
+
+// DefaultCellResolution is the cell grid used when the root element has no
+// ttp:cellResolution.
+var DefaultCellResolution = [2]int{32, 15}
+
+// Root holds the parameters of the root <tt> element that lengths depend on.
+type Root struct {
+	// Extent is the width and height of the root container in pixels, or
+	// zero when tts:extent is not given.
+	Extent [2]float64
+	// CellResolution is the number of columns and rows of the cell grid.
+	// Zero means the default grid.
+	CellResolution [2]int
+	// PixelAspectRatio is the width and height of a pixel, or zero when
+	// ttp:pixelAspectRatio is not given. It is kept for round-tripping;
+	// pixel lengths are converted against Extent alone.
+	PixelAspectRatio [2]int
+}
+
+// DefaultRoot returns the parameters of a root element that sets none.
+func DefaultRoot() Root {
+	return Root{CellResolution: DefaultCellResolution}
+}
+
+// ParseExtent parses the tts:extent of the root element, which must be in
+// pixels, such as "1920px 1080px". "auto" leaves the extent to the player
+// and gives a zero extent, as when tts:extent is not given.
+func ParseExtent(s string) ([2]float64, error) {
+	if s == "auto" {
+		return [2]float64{}, nil
+	}
+	lengths, err := ParseLengths(s)
+	if err != nil {
+		return [2]float64{}, err
+	}
+	if lengths[0].Unit != Pixel || lengths[1].Unit != Pixel || lengths[0].Value == 0 || lengths[1].Value == 0 {
+		return [2]float64{}, errs.New(errs.ErrInvalidLength, "root extent %q must be a width and height in pixels such as \"1920px 1080px\"", s)
+	}
+	return [2]float64{lengths[0].Value, lengths[1].Value}, nil
+}
+
+// ParseCellResolution parses ttp:cellResolution, such as "32 15".
+func ParseCellResolution(s string) ([2]int, error) {
+	return parsePositivePair(s, "cellResolution")
+}
+
+// ParsePixelAspectRatio parses ttp:pixelAspectRatio, such as "1 1".
+func ParsePixelAspectRatio(s string) ([2]int, error) {
+	return parsePositivePair(s, "pixelAspectRatio")
+}
+
+// parsePositivePair parses two positive integers separated by whitespace.
+func parsePositivePair(s, name string) ([2]int, error) {
+	var out [2]int
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return out, errs.New(errs.ErrInvalidLength, "invalid %s %q, expected two positive integers", name, s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 {
+			return out, errs.New(errs.ErrInvalidLength, "invalid %s %q, expected two positive integers", name, s)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// Percent converts l, measured along axis, to a percentage of the root
+// container. Pixels need the root extent.
+func (r Root) Percent(l Length, axis Axis) (float64, error) {
+	switch l.Unit {
+	case Percent:
+		return l.Value, nil
+	case Cell:
+		return l.Value * 100 / float64(r.cells()[axis]), nil
+	case Pixel:
+		if r.Extent[axis] == 0 {
+			return 0, errs.New(errs.ErrInvalidLength, "length %s in pixels needs a root extent", l)
+		}
+		return l.Value * 100 / r.Extent[axis], nil
+	}
+	return 0, errs.New(errs.ErrInvalidLength, "unknown unit in length %s", l)
+}
+
+// Percentages converts a pair of lengths, such as a tts:origin, to
+// percentages of the root container.
+func (r Root) Percentages(lengths [2]Length) ([2]float64, error) {
+	var out [2]float64
+	for i, l := range lengths {
+		v, err := r.Percent(l, Axis(i))
+		if err != nil {
+			return out, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// FormatPercent formats a percentage, rounded to two decimals, such as
+// "12.5%".
+func FormatPercent(v float64) string {
+	return Length{Value: math.Round(v*100) / 100, Unit: Percent}.String()
+}
+
+// FormatPercentages formats a pair of percentages as FormatPercent does,
+// such as "10% 80%".
+func FormatPercentages(v [2]float64) string {
+	return FormatPercent(v[0]) + " " + FormatPercent(v[1])
+}
+
+// FontSize converts a font size to a percentage of the default font size,
+// which is one cell high. Percentages are taken as relative to the default.
+func (r Root) FontSize(l Length) (float64, error) {
+	switch l.Unit {
+	case Percent:
+		return l.Value, nil
+	case Cell:
+		return l.Value * 100, nil
+	case Pixel:
+		if r.Extent[Vertical] == 0 {
+			return 0, errs.New(errs.ErrInvalidLength, "font size %s in pixels needs a root extent", l)
+		}
+		cell := r.Extent[Vertical] / float64(r.cells()[Vertical])
+		return l.Value * 100 / cell, nil
+	}
+	return 0, errs.New(errs.ErrInvalidLength, "unknown unit in font size %s", l)
+}
+
+// cells returns the cell resolution, or the default if it is not set.
+func (r Root) cells() [2]int {
+	if r.CellResolution[0] == 0 || r.CellResolution[1] == 0 {
+		return DefaultCellResolution
+	}
+	return r.CellResolution
+}
@@ -0,0 +1,151 @@
+package units
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  Length
+		expectErr bool
+	}{
+		{name: "Percent", input: "80%", expected: Length{80, Percent}},
+		{name: "Fractional Percent", input: "12.5%", expected: Length{12.5, Percent}},
+		{name: "Pixels", input: "1920px", expected: Length{1920, Pixel}},
+		{name: "Cells", input: "1.5c", expected: Length{1.5, Cell}},
+		{name: "No Unit", input: "80", expectErr: true},
+		{name: "Unknown Unit", input: "2em", expectErr: true},
+		{name: "Negative", input: "-5%", expectErr: true},
+		{name: "Empty", input: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := ParseLength(tt.input)
+			if tt.expectErr {
+				if !errors.Is(err, errs.ErrInvalidLength) {
+					t.Errorf("Expected ErrInvalidLength for input %q, got %v", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect an error for input %q, but got: %v", tt.input, err)
+			}
+			if l != tt.expected {
+				t.Errorf("For input %q, expected %v, but got %v", tt.input, tt.expected, l)
+			}
+			if l.String() != tt.input {
+				t.Errorf("Expected %v to format as %q, got %q", l, tt.input, l.String())
+			}
+		})
+	}
+}
+
+func TestRootPercentages(t *testing.T) {
+	hd := Root{Extent: [2]float64{1920, 1080}, CellResolution: [2]int{40, 20}}
+
+	tests := []struct {
+		name      string
+		root      Root
+		input     string
+		expected  [2]float64
+		expectErr bool
+	}{
+		{name: "Percent", root: DefaultRoot(), input: "10% 80%", expected: [2]float64{10, 80}},
+		{name: "Pixels", root: hd, input: "192px 864px", expected: [2]float64{10, 80}},
+		{name: "Cells", root: hd, input: "4c 2c", expected: [2]float64{10, 10}},
+		{name: "Default Cells", root: Root{}, input: "16c 3c", expected: [2]float64{50, 20}},
+		{name: "Mixed", root: hd, input: "10% 2c", expected: [2]float64{10, 10}},
+		{name: "Pixels Without Extent", root: DefaultRoot(), input: "192px 864px", expectErr: true},
+		{name: "Single Length", root: hd, input: "10%", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lengths, err := ParseLengths(tt.input)
+			var got [2]float64
+			if err == nil {
+				got, err = tt.root.Percentages(lengths)
+			}
+			if tt.expectErr {
+				if !errors.Is(err, errs.ErrInvalidLength) {
+					t.Errorf("Expected ErrInvalidLength for input %q, got %v", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect an error for input %q, but got: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("For input %q, expected %v, but got %v", tt.input, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRootFontSize(t *testing.T) {
+	hd := Root{Extent: [2]float64{1920, 1080}, CellResolution: [2]int{40, 20}}
+
+	tests := []struct {
+		name      string
+		root      Root
+		input     Length
+		expected  float64
+		expectErr bool
+	}{
+		{name: "Percent", root: hd, input: Length{80, Percent}, expected: 80},
+		{name: "Cells", root: hd, input: Length{1.5, Cell}, expected: 150},
+		{name: "Pixels", root: hd, input: Length{27, Pixel}, expected: 50},
+		{name: "Pixels Without Extent", root: DefaultRoot(), input: Length{27, Pixel}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.root.FontSize(tt.input)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error for %v, but got none", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect an error for %v, but got: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("For %v, expected %g, but got %g", tt.input, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRootParameters(t *testing.T) {
+	if extent, err := ParseExtent("1920px 1080px"); err != nil || extent != [2]float64{1920, 1080} {
+		t.Errorf("ParseExtent = %v, %v", extent, err)
+	}
+	if extent, err := ParseExtent("auto"); err != nil || extent != [2]float64{} {
+		t.Errorf("ParseExtent(auto) = %v, %v", extent, err)
+	}
+	if _, err := ParseExtent("100% 100%"); !errors.Is(err, errs.ErrInvalidLength) {
+		t.Errorf("Expected ErrInvalidLength for a root extent in percent, got %v", err)
+	}
+	if cells, err := ParseCellResolution("40 20"); err != nil || cells != [2]int{40, 20} {
+		t.Errorf("ParseCellResolution = %v, %v", cells, err)
+	}
+	if _, err := ParseCellResolution("40 0"); !errors.Is(err, errs.ErrInvalidLength) {
+		t.Errorf("Expected ErrInvalidLength for a zero cell resolution, got %v", err)
+	}
+	if par, err := ParsePixelAspectRatio("4 3"); err != nil || par != [2]int{4, 3} {
+		t.Errorf("ParsePixelAspectRatio = %v, %v", par, err)
+	}
+}
+
+func TestFormatPercentages(t *testing.T) {
+	if got, want := FormatPercentages([2]float64{10, 100.0 / 3}), "10% 33.33%"; got != want {
+		t.Errorf("FormatPercentages = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+package vtt
+
+import (
+	"strings"
+
+	"github.com/asticode/go-astisub"
+)
+
+// Unicode bidi control characters.
+const (
+	rlm = "\u200f" // right-to-left mark
+	lre = "\u202a" // left-to-right embedding
+	rle = "\u202b" // right-to-left embedding
+	pdf = "\u202c" // pop directional formatting
+	lro = "\u202d" // left-to-right override
+	rlo = "\u202e" // right-to-left override
+	lri = "\u2066" // left-to-right isolate
+	rli = "\u2067" // right-to-left isolate
+	fsi = "\u2068" // first strong isolate
+	pdi = "\u2069" // pop directional isolate
+)
+
+// bidiMarks returns the control characters that open and close a span with
+// the given tts:direction and tts:unicodeBidi, which WebVTT has no other way
+// to express. As in TTML, a direction alone does not change the text.
+func bidiMarks(direction, unicodeBidi string) (open, close string) {
+	switch unicodeBidi {
+	case "embed":
+		switch direction {
+		case "rtl":
+			return rle, pdf
+		case "ltr":
+			return lre, pdf
+		}
+	case "bidiOverride":
+		switch direction {
+		case "rtl":
+			return rlo, pdf
+		case "ltr":
+			return lro, pdf
+		}
+	case "isolate":
+		switch direction {
+		case "rtl":
+			return rli, pdi
+		case "ltr":
+			return lri, pdi
+		}
+		return fsi, pdi
+	}
+	return "", ""
+}
+
+// markDirection starts each line of the right-to-left cues in subs with a
+// right-to-left mark. WebVTT renderers take the direction of a line from its
+// first strong character, so that without the mark a line starting with
+// punctuation or a Latin word would be laid out left to right, with its
+// punctuation on the wrong side and align:start meaning left.
+func markDirection(subs *astisub.Subtitles) {
+	for _, item := range subs.Items {
+		if item.InlineStyle == nil || item.InlineStyle.TTMLDirection == nil || *item.InlineStyle.TTMLDirection != "rtl" {
+			continue
+		}
+		for i := range item.Lines {
+			items := item.Lines[i].Items
+			if len(items) > 0 && !strings.HasPrefix(items[0].Text, rlm) {
+				items[0].Text = rlm + items[0].Text
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package vtt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/units"
+)
+
+// settings are the WebVTT cue settings that place a cue where its TTML region
+// is.
+type settings struct {
+	Line     string
+	Position string
+	Size     string
+	Align    string
+	Vertical string
+}
+
+// Layout selects how WebVTT output places cues.
+type Layout int
+
+const (
+	// LayoutSettings places each cue with line, position, size and align
+	// cue settings.
+	LayoutSettings Layout = iota
+	// LayoutRegions writes a REGION block for each region and refers cues to
+	// it, for players that support WebVTT regions.
+	LayoutRegions
+)
+
+// String returns the name used for the layout on the command line.
+func (l Layout) String() string {
+	switch l {
+	case LayoutSettings:
+		return "settings"
+	case LayoutRegions:
+		return "regions"
+	}
+	return fmt.Sprintf("Layout(%d)", int(l))
+}
+
+// ParseLayout returns the layout named s ("settings" or "regions").
+func ParseLayout(s string) (Layout, error) {
+	for _, l := range []Layout{LayoutSettings, LayoutRegions} {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown layout %q, expected settings or regions", s)
+}
+
+// geometry returns the origin and extent of region as percentages of the
+// root container. It reports false when the region has no origin and extent,
+// or gives them in pixels without a root extent.
+func geometry(region parser.Region, root units.Root) (origin, extent [2]float64, ok bool) {
+	originLengths, err := units.ParseLengths(region.Origin)
+	if err != nil {
+		return origin, extent, false
+	}
+	extentLengths, err := units.ParseLengths(region.Extent)
+	if err != nil {
+		return origin, extent, false
+	}
+	if origin, err = root.Percentages(originLengths); err != nil {
+		return origin, extent, false
+	}
+	extent, err = root.Percentages(extentLengths)
+	return origin, extent, err == nil
+}
+
+// cueAlign maps the textAlign of region to the align cue setting.
+func cueAlign(region parser.Region) string {
+	switch region.TextAlign {
+	case "left", "right", "center", "end":
+		return region.TextAlign
+	}
+	// start is the TTML default.
+	return "start"
+}
+
+// vertical returns the vertical cue setting for the writing mode of region,
+// or "" for horizontal text.
+func vertical(region parser.Region) string {
+	switch region.WritingMode {
+	case "tbrl", "tb":
+		return "rl"
+	case "tblr":
+		return "lr"
+	}
+	return ""
+}
+
+// cueSettings maps region to cue settings. The cue box spans the width of
+// the region, text is aligned within it by textAlign, and the line is placed
+// at the top, middle or bottom of the region by displayAlign. Vertical text
+// runs down the height of the region instead, centred across its width. It
+// reports false when the region's geometry is unknown.
+func cueSettings(region parser.Region, root units.Root) (settings, bool) {
+	origin, extent, ok := geometry(region, root)
+	if !ok {
+		return settings{}, false
+	}
+
+	var s settings
+	s.Align = cueAlign(region)
+	if s.Vertical = vertical(region); s.Vertical != "" {
+		s.Line = formatPercent(origin[0]+extent[0]/2) + ",center"
+		s.Position = formatPercent(origin[1]) + ",line-left"
+		s.Size = formatPercent(extent[1])
+		return s, true
+	}
+	s.Position = formatPercent(origin[0]) + ",line-left"
+	s.Size = formatPercent(extent[0])
+	switch region.DisplayAlign {
+	case "center":
+		s.Line = formatPercent(origin[1]+extent[1]/2) + ",center"
+	case "after":
+		s.Line = formatPercent(origin[1]+extent[1]) + ",end"
+	default:
+		// before is the TTML default.
+		s.Line = formatPercent(origin[1]) + ",start"
+	}
+	return s, true
+}
+
+// lineHeight is the height of a line of cue text as a percentage of the
+// video height, as used by WebVTT renderers.
+const lineHeight = 5.33
+
+// regionBlock returns a WebVTT REGION block for region. The region is
+// anchored at the edge its text is displayed against, so that displayAlign
+// after regions grow upwards and scroll up. It reports false when the
+// region's geometry is unknown.
+func regionBlock(region parser.Region, root units.Root) (string, bool) {
+	origin, extent, ok := geometry(region, root)
+	if !ok {
+		return "", false
+	}
+	anchor, y := "0%", origin[1]
+	switch region.DisplayAlign {
+	case "center":
+		anchor, y = "50%", origin[1]+extent[1]/2
+	case "after":
+		anchor, y = "100%", origin[1]+extent[1]
+	}
+	lines := max(1, int(math.Round(extent[1]/lineHeight)))
+
+	var sb strings.Builder
+	sb.WriteString("REGION\n")
+	sb.WriteString("id:" + region.ID + "\n")
+	sb.WriteString("width:" + formatPercent(extent[0]) + "\n")
+	sb.WriteString("lines:" + strconv.Itoa(lines) + "\n")
+	sb.WriteString("regionanchor:0%," + anchor + "\n")
+	sb.WriteString("viewportanchor:" + formatPercent(origin[0]) + "," + formatPercent(y) + "\n")
+	if region.DisplayAlign == "after" {
+		sb.WriteString("scroll:up\n")
+	}
+	return sb.String(), true
+}
+
+// formatPercent formats v, clamped to 0-100 and rounded to two decimals, as
+// a percentage.
+func formatPercent(v float64) string {
+	return units.FormatPercent(math.Min(math.Max(v, 0), 100))
+}
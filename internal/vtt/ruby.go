@@ -0,0 +1,224 @@
+package vtt
+
+import (
+	"cmp"
+	"regexp"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+
+	"github.com/asticode/go-astisub"
+)
+
+// Styles that stand in for ruby and tate-chu-yoko spans on the way through
+// astisub, which only keeps the style of top-level spans.
+const (
+	rubyBaseStyle = "ittconv-ruby-base"
+	rubyTextStyle = "ittconv-ruby-text"
+	combineStyle  = "ittconv-tcy"
+)
+
+var (
+	// spanTagRe matches a span start, end or empty-element tag.
+	spanTagRe = regexp.MustCompile(`<(/?)span\b([^>]*?)(/?)>`)
+	// attrRe matches an attribute and its value.
+	attrRe = regexp.MustCompile(`([\w:.-]+)="([^"]*)"`)
+)
+
+// prepareText returns a copy of doc in which ruby, tate-chu-yoko, bidi and
+// speaker spans are rewritten for astisub: ruby containers and delimiters are
+// removed, and ruby bases, ruby texts and combined text get one of the
+// stand-in styles. The styles of the rewritten spans are dropped, except for
+// combined text, whose style is copied into the stand-in. Spans with a
+// tts:unicodeBidi get their bidi control characters around their text, and
+// the text of cues and spans with a ttm:agent is put between voice markers,
+// with private use characters already in the text escaped. doc is returned
+// unchanged when it has no such cues, spans or characters.
+func prepareText(doc *parser.ITTDocument) *parser.ITTDocument {
+	var out *parser.ITTDocument
+	for i, cue := range doc.Cues {
+		content, styles := rewriteSpans(doc, escapeMarkers(cue.Content))
+		if marker := voiceMarker(doc, cue.Agents); marker != "" {
+			content = marker + content + voiceClose
+		}
+		if content == cue.Content {
+			continue
+		}
+		if out == nil {
+			copied := *doc
+			copied.Cues = append([]parser.Cue(nil), doc.Cues...)
+			copied.Styles = map[string]parser.Style{}
+			for id, s := range doc.Styles {
+				copied.Styles[id] = s
+			}
+			out = &copied
+		}
+		out.Cues[i].Content = content
+		for _, s := range styles {
+			out.Styles[s.ID] = s
+		}
+	}
+	if out == nil {
+		return doc
+	}
+	return out
+}
+
+// openSpan is a span start tag met by rewriteSpans.
+type openSpan struct {
+	kept bool   // whether the end tag is written
+	mark string // bidi control character or voice marker written before the end tag
+}
+
+// rewriteSpans rewrites the ruby, tate-chu-yoko and bidi spans of content
+// and returns the stand-in styles it refers to.
+func rewriteSpans(doc *parser.ITTDocument, content string) (string, []parser.Style) {
+	var sb strings.Builder
+	var styles []parser.Style
+	var open []openSpan
+	skip := 0 // depth inside a ruby delimiter, whose text is dropped
+	last := 0
+	for _, m := range spanTagRe.FindAllStringSubmatchIndex(content, -1) {
+		if skip == 0 {
+			sb.WriteString(content[last:m[0]])
+		}
+		last = m[1]
+		tag := content[m[0]:m[1]]
+		closing, empty := m[3] > m[2], m[7] > m[6]
+		switch {
+		case closing:
+			if len(open) == 0 {
+				sb.WriteString(tag)
+				continue
+			}
+			span := open[len(open)-1]
+			open = open[:len(open)-1]
+			if skip > 0 {
+				skip--
+				continue
+			}
+			sb.WriteString(span.mark)
+			if span.kept {
+				sb.WriteString(tag)
+			}
+			continue
+		case skip > 0:
+			if !empty {
+				skip++
+				open = append(open, openSpan{})
+			}
+			continue
+		}
+
+		p := spanProperties(doc, content[m[4]:m[5]])
+		replacement, kept := tag, true
+		switch {
+		case p.ruby == "container" || p.ruby == "baseContainer" || p.ruby == "textContainer":
+			replacement, kept = "", false
+		case p.ruby == "delimiter":
+			replacement, kept = "", false
+			if !empty {
+				skip = 1
+			}
+		case p.ruby == "base":
+			replacement = `<span style="` + rubyBaseStyle + `">`
+			styles = append(styles, parser.Style{ID: rubyBaseStyle})
+		case p.ruby == "text":
+			replacement = `<span style="` + rubyTextStyle + `">`
+			styles = append(styles, parser.Style{ID: rubyTextStyle})
+		case p.combine == "all":
+			s := doc.Styles[p.style]
+			s.ID, s.TextCombine = combineStyle, p.combine
+			if p.style != "" {
+				s.ID = p.style + "-tcy"
+			}
+			replacement = `<span style="` + s.ID + `">`
+			styles = append(styles, s)
+		}
+		if empty {
+			if replacement != "" {
+				replacement = strings.TrimSuffix(replacement, ">") + "/>"
+			}
+			sb.WriteString(replacement)
+			continue
+		}
+		span := openSpan{kept: kept}
+		var mark string
+		if skip == 0 {
+			mark, span.mark = bidiMarks(p.direction, p.unicodeBidi)
+			if voice := voiceMarker(doc, p.agents); voice != "" {
+				mark, span.mark = voice+mark, span.mark+voiceClose
+			}
+		}
+		open = append(open, span)
+		sb.WriteString(replacement + mark)
+	}
+	if skip == 0 {
+		sb.WriteString(content[last:])
+	}
+	return sb.String(), styles
+}
+
+// spanProps are the properties of a span that rewriteSpans acts on.
+type spanProps struct {
+	ruby        string
+	combine     string
+	direction   string
+	unicodeBidi string
+	agents      []string // ttm:agent
+	style       string   // the first style of the span
+}
+
+// spanProperties returns the properties of a span with the given attributes,
+// set inline or through its styles. Inline values win.
+func spanProperties(doc *parser.ITTDocument, attrs string) spanProps {
+	var p, inline spanProps
+	for _, a := range attrRe.FindAllStringSubmatch(attrs, -1) {
+		name := a[1]
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name = name[i+1:]
+		}
+		switch name {
+		case "style":
+			for _, id := range strings.Fields(a[2]) {
+				if p.style == "" {
+					p.style = id
+				}
+				s := doc.Styles[id]
+				p.ruby = cmp.Or(s.Ruby, p.ruby)
+				p.combine = cmp.Or(s.TextCombine, p.combine)
+				p.direction = cmp.Or(s.Direction, p.direction)
+				p.unicodeBidi = cmp.Or(s.UnicodeBidi, p.unicodeBidi)
+			}
+		case "ruby":
+			inline.ruby = a[2]
+		case "textCombine":
+			inline.combine = a[2]
+		case "direction":
+			inline.direction = a[2]
+		case "unicodeBidi":
+			inline.unicodeBidi = a[2]
+		case "agent":
+			p.agents = strings.Fields(a[2])
+		}
+	}
+	p.ruby = cmp.Or(inline.ruby, p.ruby)
+	p.combine = cmp.Or(inline.combine, p.combine)
+	p.direction = cmp.Or(inline.direction, p.direction)
+	p.unicodeBidi = cmp.Or(inline.unicodeBidi, p.unicodeBidi)
+	return p
+}
+
+// rubyTags returns the tags that mark the text of a line item with a
+// stand-in ruby style.
+func rubyTags(style *astisub.Style) []astisub.WebVTTTag {
+	switch {
+	case style == nil:
+		return nil
+	case style.ID == rubyBaseStyle:
+		return []astisub.WebVTTTag{{Name: "ruby"}}
+	case style.ID == rubyTextStyle:
+		return []astisub.WebVTTTag{{Name: "ruby"}, {Name: "rt"}}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package vtt
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/units"
+
+	"github.com/asticode/go-astisub"
+)
+
+var (
+	// classRe matches the characters a WebVTT class name cannot use.
+	classRe = regexp.MustCompile(`[^\w-]`)
+	// rgbaRe matches a TTML rgba() color, whose alpha runs from 0 to 255.
+	rgbaRe = regexp.MustCompile(`^rgba\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*\)$`)
+)
+
+// genericFamilies maps the TTML generic font families to CSS ones.
+var genericFamilies = map[string]string{
+	"default":               "sans-serif",
+	"monospace":             "monospace",
+	"sansSerif":             "sans-serif",
+	"serif":                 "serif",
+	"monospaceSansSerif":    "monospace",
+	"monospaceSerif":        "monospace",
+	"proportionalSansSerif": "sans-serif",
+	"proportionalSerif":     "serif",
+}
+
+// textDecorations maps TTML text decorations to CSS ones. The "no" forms
+// only cancel an inherited decoration and have no CSS counterpart.
+var textDecorations = map[string]string{
+	"underline":   "underline",
+	"lineThrough": "line-through",
+	"overline":    "overline",
+}
+
+// className returns the WebVTT class used for the style with the given id.
+func className(id string) string {
+	class := classRe.ReplaceAllString(id, "-")
+	if class == "" || class[0] >= '0' && class[0] <= '9' || class[0] == '-' {
+		class = "s" + class
+	}
+	return class
+}
+
+// classNames returns a distinct WebVTT class for each of styles, by ID.
+// Styles whose IDs are valid class names keep them; when the classes of other
+// styles collide, all but the first in ID order get a numeric suffix.
+func classNames(styles map[string]parser.Style) map[string]string {
+	ids := make([]string, 0, len(styles))
+	for id := range styles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	names := map[string]string{}
+	taken := map[string]bool{}
+	for _, id := range ids {
+		if className(id) == id {
+			names[id], taken[id] = id, true
+		}
+	}
+	for _, id := range ids {
+		if _, ok := names[id]; ok {
+			continue
+		}
+		class := className(id)
+		for n := 2; taken[class]; n++ {
+			class = fmt.Sprintf("%s-%d", className(id), n)
+		}
+		names[id], taken[class] = class, true
+	}
+	return names
+}
+
+// cssDeclarations returns the CSS declarations for style, in a fixed order.
+func cssDeclarations(style parser.Style, root units.Root) []string {
+	var decls []string
+	add := func(property, value string) {
+		if value != "" {
+			decls = append(decls, property+": "+value+";")
+		}
+	}
+	add("color", cssColor(style.Color))
+	add("background-color", cssColor(style.BackgroundColor))
+	add("font-family", cssFontFamily(style.FontFamily))
+	add("font-size", cssFontSize(style.FontSize, root))
+	add("font-weight", style.FontWeight)
+	add("font-style", style.FontStyle)
+	add("text-decoration", cssTextDecoration(style.TextDecoration))
+	if style.TextCombine == "all" {
+		add("text-combine-upright", "all")
+	}
+	return decls
+}
+
+// cssColor converts a TTML color to CSS. Named colors and #rrggbb(aa) are
+// the same in both; the alpha of rgba() is scaled to the range 0 to 1.
+func cssColor(color string) string {
+	m := rgbaRe.FindStringSubmatch(color)
+	if m == nil {
+		return color
+	}
+	alpha, _ := strconv.Atoi(m[4])
+	return fmt.Sprintf("rgba(%s,%s,%s,%s)", m[1], m[2], m[3], strconv.FormatFloat(float64(alpha)/255, 'f', 3, 64))
+}
+
+// cssFontFamily converts a comma-separated list of TTML font families to
+// CSS, quoting the names that are not generic families.
+func cssFontFamily(families string) string {
+	var out []string
+	for _, f := range strings.Split(families, ",") {
+		f = strings.Trim(strings.TrimSpace(f), `"'`)
+		if f == "" {
+			continue
+		}
+		if generic, ok := genericFamilies[f]; ok {
+			out = append(out, generic)
+		} else {
+			out = append(out, strconv.Quote(f))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// cssFontSize converts a TTML font size to a percentage of the default cue
+// font size. Of a pair of sizes the last, vertical one is used; sizes that
+// cannot be converted are dropped.
+func cssFontSize(size string, root units.Root) string {
+	fields := strings.Fields(size)
+	if len(fields) == 0 {
+		return ""
+	}
+	l, err := units.ParseLength(fields[len(fields)-1])
+	if err != nil {
+		return ""
+	}
+	percent, err := root.FontSize(l)
+	if err != nil {
+		return ""
+	}
+	return units.FormatPercent(percent)
+}
+
+// cssTextDecoration converts a TTML text decoration to CSS.
+func cssTextDecoration(decoration string) string {
+	var out []string
+	for _, d := range strings.Fields(decoration) {
+		if css, ok := textDecorations[d]; ok {
+			out = append(out, css)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// styleCues wraps the text of each cue in a <c> tag with a class for each
+// style of the cue and of the span the text is in, and returns a STYLE block
+// with a ::cue rule for each class used, or nil if there are none. Styles
+// without any CSS get no class. Text with a stand-in ruby style is wrapped
+// in <ruby> and <rt> tags, inside any <v> tag.
+func styleCues(doc *parser.ITTDocument, subs *astisub.Subtitles, root units.Root) []string {
+	used := map[string]parser.Style{}
+	classOf := classNames(doc.Styles)
+	classes := func(style *astisub.Style) []string {
+		if style == nil {
+			return nil
+		}
+		s, ok := doc.Styles[style.ID]
+		if !ok || len(cssDeclarations(s, root)) == 0 {
+			return nil
+		}
+		used[classOf[s.ID]] = s
+		return []string{classOf[s.ID]}
+	}
+	for _, item := range subs.Items {
+		cueClasses := classes(item.Style)
+		for i := range item.Lines {
+			line := &item.Lines[i]
+			var items []astisub.LineItem
+			for _, li := range line.Items {
+				c := append(append([]string{}, cueClasses...), classes(li.Style)...)
+				var tags []astisub.WebVTTTag
+				if len(c) > 0 {
+					tags = append(tags, astisub.WebVTTTag{Name: "c", Classes: c})
+				}
+				tags = append(tags, rubyTags(li.Style)...)
+				if len(tags) > 0 {
+					if li.InlineStyle == nil {
+						li.InlineStyle = &astisub.StyleAttributes{}
+					} else {
+						inline := *li.InlineStyle
+						li.InlineStyle = &inline
+						// <v> tags stay outermost.
+						v := 0
+						for v < len(inline.WebVTTTags) && inline.WebVTTTags[v].Name == "v" {
+							v++
+						}
+						tags = append(append(slices.Clip(inline.WebVTTTags[:v]), tags...), inline.WebVTTTags[v:]...)
+					}
+					li.InlineStyle.WebVTTTags = tags
+				}
+				// astisub joins neighbouring tags with the same name even when
+				// their classes or annotations differ; an empty item between
+				// them keeps them apart.
+				if n := len(items); n > 0 && joined(items[n-1], li) {
+					items = append(items, astisub.LineItem{})
+				}
+				items = append(items, li)
+			}
+			line.Items = items
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString("STYLE\n")
+	for _, name := range names {
+		sb.WriteString("::cue(." + name + ") {\n")
+		for _, decl := range cssDeclarations(used[name], root) {
+			sb.WriteString("  " + decl + "\n")
+		}
+		sb.WriteString("}\n")
+	}
+	return []string{sb.String()}
+}
+
+// joined reports whether astisub would join a tag of li with a different tag
+// of prev, as it leaves out the end and start tags of neighbouring items that
+// have tags with the same name at the same position.
+func joined(prev, li astisub.LineItem) bool {
+	if prev.InlineStyle == nil || li.InlineStyle == nil {
+		return false
+	}
+	a, b := prev.InlineStyle.WebVTTTags, li.InlineStyle.WebVTTTags
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Name == b[i].Name && (a[i].Annotation != b[i].Annotation || !slices.Equal(a[i].Classes, b[i].Classes)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package vtt
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/errs"
+)
+
+var (
+	timestampRe = regexp.MustCompile(`^(?:(\d{2,}):)?(\d{2}):(\d{2})\.(\d{3})$`)
+	percentRe   = regexp.MustCompile(`^\d+(?:\.\d+)?%$`)
+	anchorRe    = regexp.MustCompile(`^\d+(?:\.\d+)?%,\d+(?:\.\d+)?%$`)
+	lineRe      = regexp.MustCompile(`^(?:-?\d+|\d+(?:\.\d+)?%)(?:,(?:start|center|end))?$`)
+	positionRe  = regexp.MustCompile(`^\d+(?:\.\d+)?%(?:,(?:line-left|center|line-right))?$`)
+	tagRe       = regexp.MustCompile(`<(/?)([^>\s.]*)([^>]*)>`)
+	metadataRe  = regexp.MustCompile(`^[^:\s]+:`)
+)
+
+// Validate checks a WebVTT document. It reports a missing or malformed
+// header, malformed or out-of-order cue timestamps, invalid cue settings,
+// unbalanced or unknown cue text tags, and STYLE or REGION blocks that
+// appear after the first cue. An empty result means the document is valid.
+//
+// The legacy "Region: id=... width=..." definitions written by go-astisub are
+// accepted in place of REGION blocks, in the header or in a block of their
+// own, and held to the same placement and syntax rules.
+func Validate(vttStr string) []errs.Finding {
+	v := &validator{regions: map[string]bool{}}
+	lines := strings.Split(strings.ReplaceAll(vttStr, "\r\n", "\n"), "\n")
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], "\uFEFF")
+	}
+	first := lines[0]
+	if first != "WEBVTT" && !strings.HasPrefix(first, "WEBVTT ") && !strings.HasPrefix(first, "WEBVTT\t") {
+		v.report(1, "missing WEBVTT header")
+		return v.findings
+	}
+
+	// Header lines run up to the first blank line.
+	i := 1
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		if strings.Contains(lines[i], "-->") {
+			v.report(i+1, "cue timing in the header; a blank line must follow the WEBVTT line")
+		} else if def, ok := strings.CutPrefix(lines[i], "Region:"); ok {
+			v.regionSettings(i+1, def, "=")
+		} else if !metadataRe.MatchString(lines[i]) {
+			v.report(i+1, fmt.Sprintf("invalid header line %q", lines[i]))
+		}
+	}
+
+	// Split the rest into blocks separated by blank lines.
+	for i < len(lines) {
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+		start := i
+		for i < len(lines) && lines[i] != "" {
+			i++
+		}
+		if start < i {
+			v.block(start+1, lines[start:i])
+		}
+	}
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		return v.findings[i].Line < v.findings[j].Line
+	})
+	return v.findings
+}
+
+type validator struct {
+	findings  []errs.Finding
+	seenCue   bool
+	lastStart float64
+	regions   map[string]bool // IDs of the regions defined so far
+}
+
+func (v *validator) report(line int, msg string) {
+	v.findings = append(v.findings, errs.Finding{Line: line, Message: msg})
+}
+
+// block validates a single block whose first line is line number at.
+func (v *validator) block(at int, lines []string) {
+	first := lines[0]
+	switch {
+	case first == "NOTE" || strings.HasPrefix(first, "NOTE ") || strings.HasPrefix(first, "NOTE\t"):
+		return
+	case first == "STYLE":
+		if v.seenCue {
+			v.report(at, "STYLE block after the first cue")
+		}
+		for j, l := range lines[1:] {
+			if strings.Contains(l, "-->") {
+				v.report(at+1+j, `STYLE block must not contain "-->"`)
+			}
+		}
+		return
+	case first == "REGION":
+		if v.seenCue {
+			v.report(at, "REGION block after the first cue")
+		}
+		for j, l := range lines[1:] {
+			v.regionSettings(at+1+j, l, ":")
+		}
+		return
+	case strings.HasPrefix(first, "Region:"):
+		if v.seenCue {
+			v.report(at, "Region definition after the first cue")
+		}
+		for j, l := range lines {
+			def, ok := strings.CutPrefix(l, "Region:")
+			if !ok {
+				v.report(at+j, fmt.Sprintf("expected a Region definition, got %q", l))
+				continue
+			}
+			v.regionSettings(at+j, def, "=")
+		}
+		return
+	}
+
+	// Cue: optional identifier followed by the timing line.
+	timing := 0
+	if !strings.Contains(first, "-->") {
+		timing = 1
+		if len(lines) < 2 || !strings.Contains(lines[1], "-->") {
+			v.report(at, fmt.Sprintf("expected cue timings, got %q", first))
+			return
+		}
+	}
+	v.seenCue = true
+	v.timings(at+timing, lines[timing])
+	for j, l := range lines[timing+1:] {
+		n := at + timing + 1 + j
+		if strings.Contains(l, "-->") {
+			v.report(n, `cue text must not contain "-->"`)
+		}
+	}
+	v.tags(at+timing+1, lines[timing+1:])
+}
+
+// timings validates a "start --> end settings" line.
+func (v *validator) timings(n int, line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[1] != "-->" {
+		v.report(n, fmt.Sprintf("malformed cue timings %q", line))
+		return
+	}
+	start, okStart := parseTimestamp(fields[0])
+	end, okEnd := parseTimestamp(fields[2])
+	if !okStart {
+		v.report(n, fmt.Sprintf("invalid start timestamp %q", fields[0]))
+	}
+	if !okEnd {
+		v.report(n, fmt.Sprintf("invalid end timestamp %q", fields[2]))
+	}
+	if okStart && okEnd && end <= start {
+		v.report(n, fmt.Sprintf("cue end %s is not after its start %s", fields[2], fields[0]))
+	}
+	if okStart {
+		if start < v.lastStart {
+			v.report(n, fmt.Sprintf("cue starts at %s, before the previous cue", fields[0]))
+		}
+		v.lastStart = start
+	}
+	v.cueSettings(n, fields[3:])
+}
+
+// cueSettings validates the settings following the cue timings.
+func (v *validator) cueSettings(n int, settings []string) {
+	seen := map[string]bool{}
+	for _, s := range settings {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok || value == "" {
+			v.report(n, fmt.Sprintf("malformed cue setting %q", s))
+			continue
+		}
+		if seen[name] {
+			v.report(n, fmt.Sprintf("duplicate cue setting %q", name))
+		}
+		seen[name] = true
+		valid := true
+		switch name {
+		case "vertical":
+			valid = value == "rl" || value == "lr"
+		case "line":
+			valid = lineRe.MatchString(value)
+		case "position":
+			valid = positionRe.MatchString(value)
+		case "size":
+			valid = percentRe.MatchString(value)
+		case "align":
+			valid = value == "start" || value == "center" || value == "end" || value == "left" || value == "right"
+		case "region":
+			if !v.regions[value] {
+				v.report(n, fmt.Sprintf("cue refers to undefined region %q", value))
+				continue
+			}
+		default:
+			v.report(n, fmt.Sprintf("unknown cue setting %q", name))
+			continue
+		}
+		if !valid {
+			v.report(n, fmt.Sprintf("invalid value %q for cue setting %q", value, name))
+		}
+	}
+}
+
+// regionSettings validates one line of region settings, where each name is
+// separated from its value by sep: ":" in REGION blocks and "=" in legacy
+// Region definitions.
+func (v *validator) regionSettings(n int, line, sep string) {
+	for _, s := range strings.Fields(line) {
+		name, value, ok := strings.Cut(s, sep)
+		if !ok || value == "" {
+			v.report(n, fmt.Sprintf("malformed region setting %q", s))
+			continue
+		}
+		valid := true
+		switch name {
+		case "id":
+			valid = !strings.Contains(value, "-->")
+			if v.regions[value] {
+				v.report(n, fmt.Sprintf("duplicate region id %q", value))
+			}
+			v.regions[value] = true
+		case "width":
+			valid = percentRe.MatchString(value)
+		case "lines":
+			_, err := strconv.ParseUint(value, 10, 32)
+			valid = err == nil
+		case "regionanchor", "viewportanchor":
+			valid = anchorRe.MatchString(value)
+		case "scroll":
+			valid = value == "up"
+		default:
+			v.report(n, fmt.Sprintf("unknown region setting %q", name))
+			continue
+		}
+		if !valid {
+			v.report(n, fmt.Sprintf("invalid value %q for region setting %q", value, name))
+		}
+	}
+}
+
+// tags checks that cue text tags are known and balanced.
+func (v *validator) tags(first int, lines []string) {
+	type open struct {
+		name string
+		line int
+	}
+	var stack []open
+	for j, l := range lines {
+		n := first + j
+		for _, m := range tagRe.FindAllStringSubmatch(l, -1) {
+			closing, name := m[1] == "/", m[2]
+			if !closing {
+				if _, ok := parseTimestamp(name + m[3]); ok {
+					continue
+				}
+			}
+			switch name {
+			case "c", "i", "b", "u", "ruby", "rt", "v", "lang":
+			default:
+				v.report(n, fmt.Sprintf("unknown cue text tag <%s%s>", m[1], name))
+				continue
+			}
+			if !closing {
+				stack = append(stack, open{name: name, line: n})
+				continue
+			}
+			// Closing a tag implicitly closes <rt> inside <ruby>, as in the
+			// WebVTT parser; anything else must match the innermost open tag.
+			if name == "ruby" && len(stack) > 0 && stack[len(stack)-1].name == "rt" {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				v.report(n, fmt.Sprintf("unbalanced closing tag </%s>", name))
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for _, o := range stack {
+		if o.name == "v" && len(stack) == 1 {
+			// A single voice span may be left open until the end of the cue.
+			continue
+		}
+		v.report(o.line, fmt.Sprintf("unclosed tag <%s>", o.name))
+	}
+}
+
+// parseTimestamp parses a WebVTT timestamp into seconds.
+func parseTimestamp(s string) (float64, bool) {
+	m := timestampRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	var h int
+	if m[1] != "" {
+		h, _ = strconv.Atoi(m[1])
+	}
+	mins, _ := strconv.Atoi(m[2])
+	secs, _ := strconv.Atoi(m[3])
+	ms, _ := strconv.Atoi(m[4])
+	if mins >= 60 || secs >= 60 {
+		return 0, false
+	}
+	return float64(h*3600+mins*60+secs) + float64(ms)/1000, true
+}
@@ -0,0 +1,131 @@
+package vtt
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/mediafellows/ittconv/internal/parser"
+
+	"github.com/asticode/go-astisub"
+)
+
+// Private use characters that prepareText puts around the text of a speaker,
+// as astisub drops ttm:agent. The text is written as voiceOpen, the speaker
+// name, voiceName, the text and voiceClose. Private use characters the source
+// already holds are escaped with voiceEscape first, so they cannot be taken
+// for markers.
+const (
+	voiceOpen   = "\ue000"
+	voiceName   = "\ue001"
+	voiceClose  = "\ue002"
+	voiceEscape = "\ue003"
+)
+
+var (
+	// annotationReplacer removes the characters a voice annotation cannot hold.
+	annotationReplacer = strings.NewReplacer(">", "", "<", "", "\n", " ", "&", "&amp;")
+	// markerEscaper and markerUnescaper escape and restore the characters
+	// used as voice markers.
+	markerEscaper = strings.NewReplacer(
+		voiceOpen, voiceEscape+"0", voiceName, voiceEscape+"1",
+		voiceClose, voiceEscape+"2", voiceEscape, voiceEscape+"3")
+	markerUnescaper = strings.NewReplacer(
+		voiceEscape+"0", voiceOpen, voiceEscape+"1", voiceName,
+		voiceEscape+"2", voiceClose, voiceEscape+"3", voiceEscape)
+)
+
+// escapeMarkers escapes the characters used as voice markers in the text of
+// content, outside of tags.
+func escapeMarkers(content string) string {
+	if !strings.ContainsAny(content, voiceOpen+voiceName+voiceClose+voiceEscape) {
+		return content
+	}
+	var sb strings.Builder
+	for content != "" {
+		end := strings.IndexByte(content, '<')
+		if end < 0 {
+			end = len(content)
+		}
+		sb.WriteString(markerEscaper.Replace(content[:end]))
+		content = content[end:]
+		if end = strings.IndexByte(content, '>'); end < 0 {
+			end = len(content) - 1
+		}
+		sb.WriteString(content[:end+1])
+		content = content[end+1:]
+	}
+	return sb.String()
+}
+
+// voiceMarker returns the marker that opens the text spoken by the agents
+// with the given IDs, escaped for TTML, or "" if there are none.
+func voiceMarker(doc *parser.ITTDocument, agents []string) string {
+	names := doc.Metadata.Speakers(agents)
+	if names == "" {
+		return ""
+	}
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(markerEscaper.Replace(names)))
+	return voiceOpen + name.String() + voiceName
+}
+
+// applyVoices removes the speaker markers from the text of subs and wraps
+// the text between them in <v> tags. Line items are split where the speaker
+// changes, and a speaker carries over line breaks. Escaped private use
+// characters are restored.
+func applyVoices(subs *astisub.Subtitles) {
+	for _, item := range subs.Items {
+		var voices []string
+		for i := range item.Lines {
+			line := &item.Lines[i]
+			var items []astisub.LineItem
+			for _, li := range line.Items {
+				if !strings.ContainsAny(li.Text, voiceOpen+voiceClose) && len(voices) == 0 {
+					li.Text = markerUnescaper.Replace(li.Text)
+					items = append(items, li)
+					continue
+				}
+				text := li.Text
+				for text != "" {
+					end := strings.IndexAny(text, voiceOpen+voiceClose)
+					if end < 0 {
+						end = len(text)
+					}
+					if end > 0 {
+						part := li
+						part.Text = markerUnescaper.Replace(text[:end])
+						if len(voices) > 0 {
+							withVoice(&part, voices[len(voices)-1])
+						}
+						items = append(items, part)
+					}
+					text = text[end:]
+					switch {
+					case strings.HasPrefix(text, voiceOpen):
+						name, rest, _ := strings.Cut(text[len(voiceOpen):], voiceName)
+						voices = append(voices, name)
+						text = rest
+					case strings.HasPrefix(text, voiceClose):
+						if len(voices) > 0 {
+							voices = voices[:len(voices)-1]
+						}
+						text = text[len(voiceClose):]
+					}
+				}
+			}
+			line.Items = items
+		}
+	}
+}
+
+// withVoice puts li in a <v> tag for the speaker name, outside its other
+// tags.
+func withVoice(li *astisub.LineItem, name string) {
+	inline := astisub.StyleAttributes{}
+	if li.InlineStyle != nil {
+		inline = *li.InlineStyle
+	}
+	voice := astisub.WebVTTTag{Name: "v", Annotation: annotationReplacer.Replace(markerUnescaper.Replace(name))}
+	inline.WebVTTTags = append([]astisub.WebVTTTag{voice}, inline.WebVTTTags...)
+	li.InlineStyle = &inline
+}
@@ -2,21 +2,54 @@ package vtt
 
 import (
 	"bytes"
+	"errors"
 	"sort"
 	"strings"
 
+	"github.com/mediafellows/ittconv/internal/errs"
 	"github.com/mediafellows/ittconv/internal/parser"
 	"github.com/mediafellows/ittconv/internal/ttml"
+	"github.com/mediafellows/ittconv/internal/units"
 
 	"github.com/asticode/go-astisub"
 )
 
+// Options configures ToVTTWithOptions.
+type Options struct {
+	// RootExtent is the size of the root container in pixels, such as
+	// "1920px 1080px", and overrides the tts:extent of the document. It
+	// converts lengths given in pixels; without either, cues in regions
+	// given in pixels get the default placement.
+	RootExtent string
+	// Layout selects between per-cue settings and REGION blocks.
+	Layout Layout
+}
+
 // ToVTT converts an ITTDocument to a VTT formatted string.
 // It does so by first converting the document to a temporary TTML string,
 // and then uses the go-astisub library to perform a high-fidelity
 // conversion from TTML to VTT, preserving styling and region information.
 func ToVTT(doc *parser.ITTDocument) (string, error) {
-	// Step 1: Convert our internal ITTDocument to a TTML string.
+	return ToVTTWithOptions(doc, Options{})
+}
+
+// ToVTTWithOptions converts an ITTDocument to a VTT formatted string
+// according to opts. Cues in a region with a known origin and extent are
+// placed with line, position, size and align settings, or refer to a REGION
+// block with LayoutRegions.
+func ToVTTWithOptions(doc *parser.ITTDocument, opts Options) (string, error) {
+	root := doc.Units
+	if opts.RootExtent != "" {
+		extent, err := units.ParseExtent(opts.RootExtent)
+		if err != nil {
+			return "", err
+		}
+		root.Extent = extent
+	}
+
+	// Step 1: Convert our internal ITTDocument to a TTML string, with ruby,
+	// tate-chu-yoko, bidi and speaker spans in a form astisub keeps.
+	doc = prepareText(doc)
 	ttmlString, err := ttml.ToTTML(doc)
 	if err != nil {
 		return "", err
@@ -25,7 +58,7 @@ func ToVTT(doc *parser.ITTDocument) (string, error) {
 	// Step 2: Use astisub to read the TTML from a string reader.
 	subs, err := astisub.ReadFromTTML(strings.NewReader(ttmlString))
 	if err != nil {
-		return "", err
+		return "", errs.New(errs.ErrValidation, "reading intermediate TTML: %w", err)
 	}
 
 	// Sort cues by timestamp to ensure deterministic output.
@@ -33,11 +66,170 @@ func ToVTT(doc *parser.ITTDocument) (string, error) {
 		return subs.Items[i].StartAt < subs.Items[j].StartAt
 	})
 
+	// astisub refuses to write an empty file, but a document whose cues were
+	// all dropped is still a valid (empty) WebVTT file.
+	if len(subs.Items) == 0 {
+		return withLanguage("WEBVTT\n", doc.Lang), nil
+	}
+
+	applyVoices(subs)
+	// Indentation around the text of a <p> comes through as blank lines,
+	// which would end the cue early in WebVTT.
+	for _, item := range subs.Items {
+		trimBlankLines(item)
+	}
+	markDirection(subs)
+
+	blocks := styleCues(doc, subs, root)
+	if opts.Layout == LayoutRegions {
+		blocks = append(blocks, regionCues(doc, subs, root)...)
+	} else {
+		placeCues(doc, subs, root)
+	}
+
 	// Step 3: Write the subtitles to a WebVTT format in a buffer.
 	var buf bytes.Buffer
 	if err := subs.WriteToWebVTT(&buf); err != nil {
-		return "", err
+		return "", errs.New(errs.ErrIO, "writing WebVTT: %w", err)
+	}
+
+	out := withLanguage(insertBlocks(buf.String(), blocks), doc.Lang)
+
+	// Check the result so that malformed WebVTT never reaches the caller.
+	if findings := Validate(out); len(findings) > 0 {
+		problems := make([]error, len(findings))
+		for i, f := range findings {
+			problems[i] = errors.New(f.String())
+		}
+		return "", errs.New(errs.ErrValidation, "generated WebVTT failed validation: %w", errors.Join(problems...))
 	}
 
-	return buf.String(), nil
+	return out, nil
+}
+
+// placeCues replaces the region reference of each cue with the cue settings
+// of its region, where the region can be mapped, and drops the region
+// definitions no cue refers to any more. References to regions in pixels
+// that cannot be mapped are dropped too, as WebVTT regions take percentages.
+func placeCues(doc *parser.ITTDocument, subs *astisub.Subtitles, root units.Root) {
+	used := map[string]bool{}
+	for _, item := range subs.Items {
+		if item.Region == nil {
+			continue
+		}
+		region := doc.Regions[item.Region.ID]
+		s, ok := cueSettings(region, root)
+		if !ok {
+			if strings.Contains(region.Origin+region.Extent, "px") {
+				item.Region = nil
+			} else {
+				used[item.Region.ID] = true
+			}
+			continue
+		}
+		applySettings(item, s)
+	}
+	for id := range subs.Regions {
+		if !used[id] {
+			delete(subs.Regions, id)
+		}
+	}
+}
+
+// applySettings places item with s instead of its region.
+func applySettings(item *astisub.Item, s settings) {
+	if item.InlineStyle == nil {
+		item.InlineStyle = &astisub.StyleAttributes{}
+	}
+	item.InlineStyle.WebVTTLine = s.Line
+	item.InlineStyle.WebVTTPosition = s.Position
+	item.InlineStyle.WebVTTSize = s.Size
+	item.InlineStyle.WebVTTAlign = s.Align
+	item.InlineStyle.WebVTTVertical = s.Vertical
+	item.Region = nil
+}
+
+// regionCues refers each cue to the REGION block of its region, aligned by
+// the region's textAlign, and returns the blocks sorted by id. astisub's
+// legacy region definitions are dropped, as are references to regions whose
+// geometry is unknown. Cues in vertical regions get cue settings instead.
+func regionCues(doc *parser.ITTDocument, subs *astisub.Subtitles, root units.Root) []string {
+	blocks := map[string]string{}
+	for _, item := range subs.Items {
+		if item.Region == nil {
+			continue
+		}
+		region := doc.Regions[item.Region.ID]
+		if vertical(region) != "" {
+			// WebVTT regions only hold horizontal text.
+			if s, ok := cueSettings(region, root); ok {
+				applySettings(item, s)
+				continue
+			}
+		}
+		block, ok := regionBlock(region, root)
+		if !ok {
+			item.Region = nil
+			continue
+		}
+		blocks[region.ID] = block
+		if item.InlineStyle == nil {
+			item.InlineStyle = &astisub.StyleAttributes{}
+		}
+		item.InlineStyle.WebVTTAlign = cueAlign(region)
+	}
+	subs.Regions = map[string]*astisub.Region{}
+
+	ids := make([]string, 0, len(blocks))
+	for id := range blocks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = blocks[id]
+	}
+	return out
+}
+
+// withLanguage adds a Language header line naming language to a WebVTT
+// document, unless language is empty.
+func withLanguage(vtt, language string) string {
+	if language == "" {
+		return vtt
+	}
+	header, rest, _ := strings.Cut(vtt, "\n")
+	return header + "\nLanguage: " + language + "\n" + rest
+}
+
+// insertBlocks inserts blocks after the header of a WebVTT document.
+func insertBlocks(vtt string, blocks []string) string {
+	if len(blocks) == 0 {
+		return vtt
+	}
+	header, rest, _ := strings.Cut(vtt, "\n\n")
+	return header + "\n\n" + strings.Join(blocks, "\n") + "\n" + rest
+}
+
+// trimBlankLines removes the lines of item that hold only whitespace and trims
+// the whitespace around the text of the remaining lines.
+func trimBlankLines(item *astisub.Item) {
+	var lines []astisub.Line
+	for _, line := range item.Lines {
+		blank := true
+		for _, li := range line.Items {
+			if strings.TrimSpace(li.Text) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+		first, last := &line.Items[0], &line.Items[len(line.Items)-1]
+		first.Text = strings.TrimLeft(first.Text, " \t\n")
+		last.Text = strings.TrimRight(last.Text, " \t\n")
+		lines = append(lines, line)
+	}
+	item.Lines = lines
 }
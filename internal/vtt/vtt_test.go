@@ -1,9 +1,12 @@
 package vtt
 
 import (
+	"errors"
 	"math/big"
+	"strings"
 	"testing"
 
+	"github.com/mediafellows/ittconv/internal/errs"
 	"github.com/mediafellows/ittconv/internal/parser"
 
 	"github.com/google/go-cmp/cmp"
@@ -48,3 +51,484 @@ Break
 		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestToVTT_Invalid(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Cues: []parser.Cue{
+			{Begin: big.NewRat(1000, 1), End: big.NewRat(1000, 1), Content: "Empty"},
+			{Begin: big.NewRat(3000, 1), End: big.NewRat(2000, 1), Content: "Inverted"},
+		},
+	}
+
+	_, err := ToVTT(doc)
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("Expected ErrValidation, got %v", err)
+	}
+	want := "generated WebVTT failed validation: " +
+		"4: cue end 00:00:01.000 is not after its start 00:00:01.000\n" +
+		"8: cue end 00:00:02.000 is not after its start 00:00:03.000"
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		t.Errorf("Error mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestToVTTWithOptions_Layout(t *testing.T) {
+	regions := map[string]parser.Region{
+		"top":    {ID: "top", Origin: "10% 10%", Extent: "80% 10%", TextAlign: "center", DisplayAlign: "before"},
+		"bottom": {ID: "bottom", Origin: "10% 80%", Extent: "80% 10%", TextAlign: "center", DisplayAlign: "after"},
+		"left":   {ID: "left", Origin: "5% 40%", Extent: "40% 10%", TextAlign: "start", DisplayAlign: "center"},
+		"pixels": {ID: "pixels", Origin: "192px 864px", Extent: "1536px 108px", TextAlign: "right", DisplayAlign: "after"},
+		"bare":   {ID: "bare"},
+	}
+	tests := []struct {
+		name       string
+		region     string
+		rootExtent string
+		want       string
+	}{
+		{"before", "top", "", "align:center line:10%,start position:10%,line-left size:80%"},
+		{"after", "bottom", "", "align:center line:90%,end position:10%,line-left size:80%"},
+		{"center", "left", "", "align:start line:45%,center position:5%,line-left size:40%"},
+		{"pixels", "pixels", "1920px 1080px", "align:right line:90%,end position:10%,line-left size:80%"},
+		{"pixels without root extent", "pixels", "", ""},
+		{"no geometry", "bare", "", "region:bare"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &parser.ITTDocument{
+				Regions: regions,
+				Cues: []parser.Cue{
+					{Begin: big.NewRat(1000, 1), End: big.NewRat(2000, 1), RegionID: tt.region, Content: "Text"},
+				},
+			}
+			got, err := ToVTTWithOptions(doc, Options{RootExtent: tt.rootExtent})
+			if err != nil {
+				t.Fatalf("ToVTTWithOptions failed: %v", err)
+			}
+			lines := strings.Split(got, "\n")
+			var timing string
+			for _, line := range lines {
+				if strings.Contains(line, "-->") {
+					timing = line
+				}
+			}
+			if want := strings.TrimSpace("00:00:01.000 --> 00:00:02.000 " + tt.want); timing != want {
+				t.Errorf("timing line = %q, want %q", timing, want)
+			}
+		})
+	}
+
+	if _, err := ToVTTWithOptions(&parser.ITTDocument{}, Options{RootExtent: "100% 100%"}); err == nil {
+		t.Error("Expected an error for a root extent not in pixels")
+	}
+}
+
+func TestToVTTWithOptions_Regions(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Regions: map[string]parser.Region{
+			"top":    {ID: "top", Origin: "10% 10%", Extent: "80% 10%", TextAlign: "center", DisplayAlign: "before"},
+			"bottom": {ID: "bottom", Origin: "192px 864px", Extent: "1536px 162px", TextAlign: "start", DisplayAlign: "after"},
+			"bare":   {ID: "bare"},
+		},
+		Cues: []parser.Cue{
+			{Begin: big.NewRat(1000, 1), End: big.NewRat(2000, 1), RegionID: "bottom", Content: "Bottom"},
+			{Begin: big.NewRat(3000, 1), End: big.NewRat(4000, 1), RegionID: "top", Content: "Top"},
+			{Begin: big.NewRat(5000, 1), End: big.NewRat(6000, 1), RegionID: "bare", Content: "Bare"},
+		},
+	}
+
+	want := `WEBVTT
+
+REGION
+id:bottom
+width:80%
+lines:3
+regionanchor:0%,100%
+viewportanchor:10%,95%
+scroll:up
+
+REGION
+id:top
+width:80%
+lines:2
+regionanchor:0%,0%
+viewportanchor:10%,10%
+
+1
+00:00:01.000 --> 00:00:02.000 align:start region:bottom
+Bottom
+
+2
+00:00:03.000 --> 00:00:04.000 align:center region:top
+Top
+
+3
+00:00:05.000 --> 00:00:06.000
+Bare
+`
+
+	got, err := ToVTTWithOptions(doc, Options{Layout: LayoutRegions, RootExtent: "1920px 1080px"})
+	if err != nil {
+		t.Fatalf("ToVTTWithOptions failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestToVTT_Styles(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Styles: map[string]parser.Style{
+			"base":  {ID: "base", Color: "#ffffff", FontFamily: "proportionalSansSerif, Arial Unicode", FontSize: "100% 80%"},
+			"em":    {ID: "em", FontStyle: "italic", TextDecoration: "underline lineThrough"},
+			"box":   {ID: "box", BackgroundColor: "rgba(0,0,0,204)", FontWeight: "bold"},
+			"cells": {ID: "cells", FontSize: "1.5c"},
+		},
+		Cues: []parser.Cue{
+			{
+				Begin:    big.NewRat(1000, 1),
+				End:      big.NewRat(2000, 1),
+				StyleIDs: []string{"base"},
+				Content:  `One <span style="em">two</span><span style="box">three</span>`,
+			},
+			{
+				Begin:    big.NewRat(3000, 1),
+				End:      big.NewRat(4000, 1),
+				StyleIDs: []string{"cells"},
+				Content:  "Plain",
+			},
+		},
+	}
+
+	want := `WEBVTT
+
+STYLE
+::cue(.base) {
+  color: #ffffff;
+  font-family: sans-serif, "Arial Unicode";
+  font-size: 80%;
+}
+::cue(.box) {
+  background-color: rgba(0,0,0,0.800);
+  font-weight: bold;
+}
+::cue(.cells) {
+  font-size: 150%;
+}
+::cue(.em) {
+  font-style: italic;
+  text-decoration: underline line-through;
+}
+
+1
+00:00:01.000 --> 00:00:02.000
+<c.base>One </c><c.base.em>two</c><c.base.box>three</c>
+
+2
+00:00:03.000 --> 00:00:04.000
+<c.cells>Plain</c>
+`
+
+	got, err := ToVTT(doc)
+	if err != nil {
+		t.Fatalf("ToVTT failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestToVTT_StyleClassCollisions(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Styles: map[string]parser.Style{
+			"s.1": {ID: "s.1", Color: "#ff0000"},
+			"s-1": {ID: "s-1", Color: "#00ff00"},
+			"s:1": {ID: "s:1", Color: "#0000ff"},
+		},
+		Cues: []parser.Cue{
+			{
+				Begin:   big.NewRat(1000, 1),
+				End:     big.NewRat(2000, 1),
+				Content: `<span style="s.1">red </span><span style="s-1">green </span><span style="s:1">blue</span>`,
+			},
+		},
+	}
+
+	want := `WEBVTT
+
+STYLE
+::cue(.s-1) {
+  color: #00ff00;
+}
+::cue(.s-1-2) {
+  color: #ff0000;
+}
+::cue(.s-1-3) {
+  color: #0000ff;
+}
+
+1
+00:00:01.000 --> 00:00:02.000
+<c.s-1-2>red </c><c.s-1>green </c><c.s-1-3>blue</c>
+`
+
+	got, err := ToVTT(doc)
+	if err != nil {
+		t.Fatalf("ToVTT failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestToVTT_Japanese(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Styles: map[string]parser.Style{
+			"base":  {ID: "base", Ruby: "base"},
+			"text":  {ID: "text", Ruby: "text"},
+			"emph":  {ID: "emph", Color: "yellow"},
+			"combo": {ID: "combo", TextCombine: "all"},
+		},
+		Regions: map[string]parser.Region{
+			"right": {ID: "right", Origin: "80% 10%", Extent: "10% 80%", WritingMode: "tbrl"},
+		},
+		Cues: []parser.Cue{
+			{
+				Begin:    big.NewRat(1000, 1),
+				End:      big.NewRat(2000, 1),
+				RegionID: "right",
+				Content: `<span tts:ruby="container"><span tts:ruby="base">漢字</span>` +
+					`<span tts:ruby="delimiter">(</span><span tts:ruby="text">かんじ</span>` +
+					`<span tts:ruby="delimiter">)</span></span>を<span style="emph" tts:textCombine="all">12</span>回`,
+			},
+			{
+				Begin:   big.NewRat(3000, 1),
+				End:     big.NewRat(4000, 1),
+				Content: `<span style="base">東京</span><span style="text">とうきょう</span>の<span style="combo">3</span>`,
+			},
+		},
+	}
+
+	want := `WEBVTT
+
+STYLE
+::cue(.combo-tcy) {
+  text-combine-upright: all;
+}
+::cue(.emph-tcy) {
+  color: yellow;
+  text-combine-upright: all;
+}
+
+1
+00:00:01.000 --> 00:00:02.000 align:start line:85%,center position:10%,line-left size:80% vertical:rl
+<ruby>漢字<rt>かんじ</rt></ruby>を<c.emph-tcy>12</c>回
+
+2
+00:00:03.000 --> 00:00:04.000
+<ruby>東京<rt>とうきょう</rt></ruby>の<c.combo-tcy>3</c>
+`
+
+	for _, layout := range []Layout{LayoutSettings, LayoutRegions} {
+		got, err := ToVTTWithOptions(doc, Options{Layout: layout})
+		if err != nil {
+			t.Fatalf("ToVTTWithOptions failed: %v", err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("VTT output mismatch with layout %s (-want +got):\n%s", layout, diff)
+		}
+	}
+	if !strings.Contains(doc.Cues[0].Content, `tts:ruby="delimiter"`) {
+		t.Error("Expected the document to be left unchanged")
+	}
+}
+
+func TestToVTT_RightToLeft(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Lang: "ar",
+		Styles: map[string]parser.Style{
+			"latin": {ID: "latin", Direction: "ltr", UnicodeBidi: "embed"},
+		},
+		Regions: map[string]parser.Region{
+			"bottom": {ID: "bottom", Origin: "10% 80%", Extent: "80% 10%"},
+		},
+		Cues: []parser.Cue{
+			{
+				Begin:    big.NewRat(1000, 1),
+				End:      big.NewRat(2000, 1),
+				RegionID: "bottom",
+				Content:  "- مرحبا بكم في <span style=\"latin\">New York</span>!<br/>أهلا",
+			},
+			{
+				Begin:   big.NewRat(3000, 1),
+				End:     big.NewRat(4000, 1),
+				Content: `<span tts:direction="rtl" tts:unicodeBidi="isolate">עברית</span> text`,
+			},
+			{
+				Begin:     big.NewRat(5000, 1),
+				End:       big.NewRat(6000, 1),
+				Direction: "ltr",
+				Content:   "Hello",
+			},
+		},
+	}
+
+	want := "WEBVTT\nLanguage: ar\n\n" +
+		"1\n00:00:01.000 --> 00:00:02.000 align:start line:80%,start position:10%,line-left size:80%\n" +
+		"\u200f- مرحبا بكم في \u202aNew York\u202c!\n\u200fأهلا\n\n" +
+		"2\n00:00:03.000 --> 00:00:04.000\n" +
+		"\u200f\u2067עברית\u2069 text\n\n" +
+		"3\n00:00:05.000 --> 00:00:06.000\n" +
+		"Hello\n"
+
+	got, err := ToVTT(doc)
+	if err != nil {
+		t.Fatalf("ToVTT failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestToVTT_Voices(t *testing.T) {
+	doc := &parser.ITTDocument{
+		Styles: map[string]parser.Style{
+			"it": {ID: "it", FontStyle: "italic"},
+		},
+		Metadata: parser.Metadata{
+			Agents: []parser.Agent{
+				{ID: "alice", Names: []parser.AgentName{{Type: "alias", Name: "Alice"}}},
+				{ID: "bob", Names: []parser.AgentName{{Type: "alias", Name: "Bob & Co"}}},
+			},
+		},
+		Cues: []parser.Cue{
+			{
+				Begin:   big.NewRat(1000, 1),
+				End:     big.NewRat(2000, 1),
+				Agents:  []string{"alice"},
+				Content: `Hello <span style="it">there</span><br/>friend`,
+			},
+			{
+				Begin:   big.NewRat(3000, 1),
+				End:     big.NewRat(4000, 1),
+				Content: `<span ttm:agent="alice">- Hi</span><br/><span ttm:agent="bob" style="it">- Hey</span>`,
+			},
+			{
+				Begin:   big.NewRat(5000, 1),
+				End:     big.NewRat(6000, 1),
+				Agents:  []string{"carol"},
+				Content: "Who?",
+			},
+			{
+				// Private use characters, such as custom glyphs, are kept.
+				Begin:   big.NewRat(7000, 1),
+				End:     big.NewRat(8000, 1),
+				Agents:  []string{"alice"},
+				Content: "\ue000\ue001 glyphs \ue002\ue003",
+			},
+			{
+				Begin:   big.NewRat(9000, 1),
+				End:     big.NewRat(10000, 1),
+				Content: "\ue000 unspoken \ue002",
+			},
+		},
+	}
+
+	want := "WEBVTT\n\nSTYLE\n::cue(.it) {\n  font-style: italic;\n}\n\n" +
+		"1\n00:00:01.000 --> 00:00:02.000\n" +
+		"<v Alice>Hello <c.it>there</c></v>\n<v Alice>friend</v>\n\n" +
+		"2\n00:00:03.000 --> 00:00:04.000\n" +
+		"<v Alice>- Hi</v>\n<v Bob &amp; Co><c.it>- Hey</c></v>\n\n" +
+		"3\n00:00:05.000 --> 00:00:06.000\n" +
+		"<v carol>Who?</v>\n\n" +
+		"4\n00:00:07.000 --> 00:00:08.000\n" +
+		"<v Alice>\ue000\ue001 glyphs \ue002\ue003</v>\n\n" +
+		"5\n00:00:09.000 --> 00:00:10.000\n" +
+		"\ue000 unspoken \ue002\n"
+
+	got, err := ToVTT(doc)
+	if err != nil {
+		t.Fatalf("ToVTT failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VTT output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "Valid",
+			input: "WEBVTT\nRegion: id=r1 width=80% lines=2\n\nRegion: id=r2 width=40% regionanchor=0%,100%\n\n" +
+				"STYLE\n::cue(.yellow) { color: yellow }\n\nREGION\nid:r3 viewportanchor:10%,90%\n\n" +
+				"NOTE a comment\n\n1\n00:00:01.000 --> 00:00:02.500 region:r2 line:85% position:50%,center align:center\n<c.yellow>Hello</c> <i>World</i>\n\n" +
+				"01:00:03.000 --> 01:00:04.000\n<v Bob>Hi <00:00:03.500>there\n",
+		},
+		{
+			name:  "MissingHeader",
+			input: "00:00:01.000 --> 00:00:02.000\nHi\n",
+			want:  []string{"1: missing WEBVTT header"},
+		},
+		{
+			name:  "Timestamps",
+			input: "WEBVTT\n\n00:00:05.000 --> 00:00:04.000\nA\n\n00:00:01.000 --> 00:00:02.00\nB\n\n0:00:03.000 --> 00:60:00.000\nC\n",
+			want: []string{
+				"3: cue end 00:00:04.000 is not after its start 00:00:05.000",
+				`6: invalid end timestamp "00:00:02.00"`,
+				"6: cue starts at 00:00:01.000, before the previous cue",
+				`9: invalid start timestamp "0:00:03.000"`,
+				`9: invalid end timestamp "00:60:00.000"`,
+			},
+		},
+		{
+			name:  "Settings",
+			input: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000 line:high align:middle size:50% size:40% foo:bar\nHi\n",
+			want: []string{
+				`3: invalid value "high" for cue setting "line"`,
+				`3: invalid value "middle" for cue setting "align"`,
+				`3: duplicate cue setting "size"`,
+				`3: unknown cue setting "foo"`,
+			},
+		},
+		{
+			name:  "Tags",
+			input: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n<i>Hi <b>there</i>\n<font>x</font> <u>open\n",
+			want: []string{
+				"4: unbalanced closing tag </i>",
+				"4: unclosed tag <i>",
+				"4: unclosed tag <b>",
+				"5: unknown cue text tag <font>",
+				"5: unknown cue text tag </font>",
+				"5: unclosed tag <u>",
+			},
+		},
+		{
+			name:  "BlockPlacement",
+			input: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000 region:r1\nHi\n\nSTYLE\n::cue { color: red }\n\nREGION\nid:r1 width:40 scroll:down\n\nRegion: id=r2\n",
+			want: []string{
+				`3: cue refers to undefined region "r1"`,
+				"6: STYLE block after the first cue",
+				"9: REGION block after the first cue",
+				`10: invalid value "40" for region setting "width"`,
+				`10: invalid value "down" for region setting "scroll"`,
+				"12: Region definition after the first cue",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Validate(tt.input) {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Validate findings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,25 +1,255 @@
 package ittconv
 
 import (
+	"time"
+
+	"github.com/mediafellows/ittconv/internal/lang"
 	"github.com/mediafellows/ittconv/internal/parser"
+	"github.com/mediafellows/ittconv/internal/transform"
 	"github.com/mediafellows/ittconv/internal/ttml"
 	"github.com/mediafellows/ittconv/internal/vtt"
 )
 
+// Diagnostic records a problem that was repaired instead of failing the
+// conversion.
+type Diagnostic = parser.Diagnostic
+
+// RepairStrategy selects how lenient conversion handles cues whose begin time
+// is not before their end time.
+type RepairStrategy = parser.RepairStrategy
+
+// Repair strategies for lenient conversion.
+const (
+	RepairDrop   = parser.RepairDrop
+	RepairSwap   = parser.RepairSwap
+	RepairExtend = parser.RepairExtend
+)
+
+// ParseRepairStrategy returns the strategy named s ("drop", "swap" or "extend").
+func ParseRepairStrategy(s string) (RepairStrategy, error) {
+	return parser.ParseRepairStrategy(s)
+}
+
+// ReferencePolicy selects how references to undefined styles and regions are
+// handled.
+type ReferencePolicy = parser.ReferencePolicy
+
+// Reference policies for undefined style and region references.
+const (
+	ReferenceKeep    = parser.ReferenceKeep
+	ReferenceDrop    = parser.ReferenceDrop
+	ReferenceDefault = parser.ReferenceDefault
+	ReferenceFail    = parser.ReferenceFail
+)
+
+// ParseReferencePolicy returns the policy named s ("keep", "drop", "default"
+// or "fail").
+func ParseReferencePolicy(s string) (ReferencePolicy, error) {
+	return parser.ParseReferencePolicy(s)
+}
+
+// OverlapStrategy selects how cues that overlap in time are resolved.
+type OverlapStrategy = transform.OverlapStrategy
+
+// Overlap strategies.
+const (
+	OverlapKeep  = transform.OverlapKeep
+	OverlapTrim  = transform.OverlapTrim
+	OverlapMerge = transform.OverlapMerge
+	OverlapStack = transform.OverlapStack
+)
+
+// ParseOverlapStrategy returns the strategy named s ("keep", "trim", "merge"
+// or "stack").
+func ParseOverlapStrategy(s string) (OverlapStrategy, error) {
+	return transform.ParseOverlapStrategy(s)
+}
+
+// NormalizeRule is a set of text clean-ups; rules combine with |.
+type NormalizeRule = transform.NormalizeRule
+
+// Text normalization rules.
+const (
+	NormalizeIndent         = transform.NormalizeIndent
+	NormalizeSpaces         = transform.NormalizeSpaces
+	NormalizeBreaks         = transform.NormalizeBreaks
+	NormalizeCurlyQuotes    = transform.NormalizeCurlyQuotes
+	NormalizeStraightQuotes = transform.NormalizeStraightQuotes
+	NormalizeEllipsis       = transform.NormalizeEllipsis
+	NormalizeDashes         = transform.NormalizeDashes
+
+	DefaultNormalizeRules = transform.DefaultNormalizeRules
+)
+
+// ParseNormalizeRules returns the set of rules named in names ("indent",
+// "spaces", "breaks", "curly-quotes", "straight-quotes", "ellipsis" or
+// "dashes").
+func ParseNormalizeRules(names []string) (NormalizeRule, error) {
+	return transform.ParseNormalizeRules(names)
+}
+
+// Layout selects how WebVTT output places cues.
+type Layout = vtt.Layout
+
+// WebVTT layouts.
+const (
+	LayoutSettings = vtt.LayoutSettings
+	LayoutRegions  = vtt.LayoutRegions
+)
+
+// ParseLayout returns the layout named s ("settings" or "regions").
+func ParseLayout(s string) (Layout, error) {
+	return vtt.ParseLayout(s)
+}
+
+// Options configures ToTTMLWithOptions and ToVTTWithOptions. The zero value
+// behaves like ToTTML and ToVTT.
+type Options struct {
+	// Lenient repairs or drops invalid cues instead of failing.
+	Lenient bool
+	// CollectErrors reports every problem in the source, joined with
+	// errors.Join, instead of stopping at the first one. Ignored when
+	// Lenient is set.
+	CollectErrors bool
+	// Repair selects how invalid cues are handled in lenient mode.
+	Repair RepairStrategy
+	// MinDuration is the cue duration used by RepairExtend.
+	MinDuration time.Duration
+	// References selects how references to undefined styles and regions are
+	// handled.
+	References ReferencePolicy
+	// DefaultStyle and DefaultRegion replace unknown references under
+	// ReferenceDefault.
+	DefaultStyle  string
+	DefaultRegion string
+	// Normalize selects the clean-ups applied to the text of every cue
+	// before any other transform.
+	Normalize NormalizeRule
+	// StripSDH removes sound descriptions, music notes and speaker labels
+	// from cues, to derive plain subtitles from subtitles for the deaf and
+	// hard of hearing. Cues left without text are removed.
+	StripSDH bool
+	// MergeStripped merges a cue into the cue before it when StripSDH leaves
+	// both with the same text and at most MergeStrippedGap separates them.
+	MergeStripped    bool
+	MergeStrippedGap time.Duration
+	// Overlaps selects how cues that overlap in time are resolved.
+	Overlaps OverlapStrategy
+	// MinGapFrames is the minimum gap between consecutive cues, in frames.
+	// Shorter gaps are widened by trimming the earlier cue.
+	MinGapFrames int
+	// ChainFrames closes gaps shorter than this many frames down to
+	// MinGapFrames by extending the earlier cue.
+	ChainFrames int
+	// SplitDuration and SplitChars split cues that last longer or hold more
+	// characters at line breaks and sentence ends.
+	SplitDuration time.Duration
+	SplitChars    int
+	// MergeDuration merges cues shorter than this with the following cue
+	// when both share a region and styles and at most MergeGap separates
+	// them.
+	MergeDuration time.Duration
+	MergeGap      time.Duration
+	// WrapChars rewraps cues with lines longer than this many characters,
+	// aiming for at most WrapLines lines. Zero disables wrapping.
+	WrapChars int
+	WrapLines int
+	// RootExtent is the size of the video in pixels, such as "1920px 1080px",
+	// used to convert lengths given in pixels in WebVTT output. It overrides
+	// the tts:extent of the source.
+	RootExtent string
+	// Layout selects whether WebVTT output places cues with per-cue
+	// settings or with REGION blocks.
+	Layout Layout
+	// Language replaces the xml:lang of the source document, such as "en-US".
+	// It must be a BCP 47 language tag and is normalized like xml:lang.
+	// Paragraphs and divisions with their own xml:lang keep it.
+	Language string
+	// Title, Description and Copyright replace the ttm:title, ttm:desc and
+	// ttm:copyright metadata of the source in TTML output.
+	Title       string
+	Description string
+	Copyright   string
+	// OnDiagnostic, if set, is called for every problem that was repaired
+	// and every cue that was changed.
+	OnDiagnostic func(Diagnostic)
+}
+
 // ToTTML converts an ITT source string to a TTML formatted string.
 func ToTTML(ittSource string) (string, error) {
-	doc, err := parser.ParseITT(ittSource)
+	return ToTTMLWithOptions(ittSource, Options{})
+}
+
+// ToVTT converts an ITT source string to a WebVTT formatted string.
+func ToVTT(ittSource string) (string, error) {
+	return ToVTTWithOptions(ittSource, Options{})
+}
+
+// ToTTMLWithOptions converts an ITT source string to a TTML formatted string
+// according to opts.
+func ToTTMLWithOptions(ittSource string, opts Options) (string, error) {
+	doc, err := parse(ittSource, opts)
 	if err != nil {
 		return "", err
 	}
 	return ttml.ToTTML(doc)
 }
 
-// ToVTT converts an ITT source string to a WebVTT formatted string.
-func ToVTT(ittSource string) (string, error) {
-	doc, err := parser.ParseITT(ittSource)
+// ToVTTWithOptions converts an ITT source string to a WebVTT formatted string
+// according to opts.
+func ToVTTWithOptions(ittSource string, opts Options) (string, error) {
+	doc, err := parse(ittSource, opts)
 	if err != nil {
 		return "", err
 	}
-	return vtt.ToVTT(doc)
+	return vtt.ToVTTWithOptions(doc, vtt.Options{RootExtent: opts.RootExtent, Layout: opts.Layout})
+}
+
+// parse parses ittSource, applies the transforms selected in opts and reports
+// diagnostics through opts.OnDiagnostic.
+func parse(ittSource string, opts Options) (*parser.ITTDocument, error) {
+	doc, err := parser.ParseITTWithOptions(ittSource, parser.Options{
+		Lenient:       opts.Lenient,
+		CollectErrors: opts.CollectErrors,
+		Repair:        opts.Repair,
+		MinDuration:   opts.MinDuration,
+		References:    opts.References,
+		DefaultStyle:  opts.DefaultStyle,
+		DefaultRegion: opts.DefaultRegion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Language != "" {
+		if doc.Lang, err = lang.Normalize(opts.Language); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Title != "" {
+		doc.Metadata.Title = opts.Title
+	}
+	if opts.Description != "" {
+		doc.Metadata.Desc = opts.Description
+	}
+	if opts.Copyright != "" {
+		doc.Metadata.Copyright = opts.Copyright
+	}
+	split := transform.SplitOptions{MaxDuration: opts.SplitDuration, MaxChars: opts.SplitChars}
+	transform.NormalizeText(doc, opts.Normalize)
+	if opts.StripSDH {
+		transform.StripSDH(doc, transform.SDHOptions{Merge: opts.MergeStripped, MaxGap: opts.MergeStrippedGap})
+	}
+	transform.ResolveOverlaps(doc, opts.Overlaps)
+	transform.MergeCues(doc, transform.MergeOptions{MinDuration: opts.MergeDuration, MaxGap: opts.MergeGap, Limits: split})
+	transform.SplitCues(doc, split)
+	transform.WrapLines(doc, transform.WrapOptions{MaxChars: opts.WrapChars, MaxLines: opts.WrapLines})
+	if _, err := transform.EnforceGaps(doc, transform.GapOptions{MinGapFrames: opts.MinGapFrames, ChainFrames: opts.ChainFrames}); err != nil {
+		return nil, err
+	}
+	if opts.OnDiagnostic != nil {
+		for _, d := range doc.Diagnostics {
+			opts.OnDiagnostic(d)
+		}
+	}
+	return doc, nil
 }
@@ -2,6 +2,7 @@ package ittconv
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -153,3 +154,116 @@ func TestConversionChainFixtures(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorCategories(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		source   string
+		wantErr  error
+		wantLine int
+	}{
+		{name: "MissingFrameRate", path: "testdata/no_framerate.itt", wantErr: ErrMissingFrameRate, wantLine: 1},
+		{name: "InvertedTiming", path: "testdata/invalid_time_range.itt", wantErr: ErrCueTimingInverted, wantLine: 8},
+		{name: "InvalidDivBegin", source: `<tt ttp:frameRate="24"><body><div begin="bogus"/></body></tt>`, wantErr: ErrInvalidTimecode, wantLine: 1},
+		{name: "InvalidFrameRate", source: `<tt ttp:frameRate="fast"><body/></tt>`, wantErr: ErrInvalidFrameRate, wantLine: 1},
+		{name: "MalformedXML", source: `<tt ttp:frameRate="24"><p a=b>`, wantErr: ErrMalformedXML, wantLine: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := tc.source
+			if tc.path != "" {
+				data, err := ioutil.ReadFile(tc.path)
+				if err != nil {
+					t.Fatalf("Failed to read test fixture %s: %v", tc.path, err)
+				}
+				source = string(data)
+			}
+
+			_, err := ToTTML(source)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected error matching %v, got: %v", tc.wantErr, err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError, got %T", err)
+			}
+			if pe.Line != tc.wantLine {
+				t.Errorf("Expected error on line %d, got line %d", tc.wantLine, pe.Line)
+			}
+		})
+	}
+}
+
+func TestToVTTWithOptions_Overlaps(t *testing.T) {
+	const source = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:timeBase="smpte" ttp:frameRate="25"><body><div>
+<p begin="00:00:01:00" end="00:00:03:00">First</p>
+<p begin="00:00:02:00" end="00:00:04:00">Second</p>
+</div></body></tt>`
+
+	var diags []Diagnostic
+	vttOutput, err := ToVTTWithOptions(source, Options{
+		Overlaps:     OverlapTrim,
+		OnDiagnostic: func(d Diagnostic) { diags = append(diags, d) },
+	})
+	if err != nil {
+		t.Fatalf("ToVTTWithOptions failed: %v", err)
+	}
+	if !strings.Contains(vttOutput, "00:00:01.000 --> 00:00:02.000\nFirst") {
+		t.Errorf("Expected the first cue to be trimmed, got:\n%s", vttOutput)
+	}
+	if len(diags) != 1 || diags[0].Err.Line != 2 {
+		t.Errorf("Expected one diagnostic on line 2, got %v", diags)
+	}
+}
+
+func TestToVTTWithOptions_Language(t *testing.T) {
+	const source = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:timeBase="smpte" ttp:frameRate="25" xml:lang="EN_us"><body><div>
+<p begin="00:00:01:00" end="00:00:02:00">Hello</p>
+</div></body></tt>`
+
+	vttOutput, err := ToVTT(source)
+	if err != nil {
+		t.Fatalf("ToVTT failed: %v", err)
+	}
+	if !strings.HasPrefix(vttOutput, "WEBVTT\nLanguage: en-US\n\n") {
+		t.Errorf("Expected the normalized language in the header, got:\n%s", vttOutput)
+	}
+
+	vttOutput, err = ToVTTWithOptions(source, Options{Language: "pt-br"})
+	if err != nil {
+		t.Fatalf("ToVTTWithOptions failed: %v", err)
+	}
+	if !strings.HasPrefix(vttOutput, "WEBVTT\nLanguage: pt-BR\n\n") {
+		t.Errorf("Expected the overriding language in the header, got:\n%s", vttOutput)
+	}
+
+	ttmlOutput, err := ToTTMLWithOptions(source, Options{Language: "pt-br"})
+	if err != nil {
+		t.Fatalf("ToTTMLWithOptions failed: %v", err)
+	}
+	if !strings.Contains(ttmlOutput, `xml:lang="pt-BR"`) {
+		t.Errorf("Expected the overriding language on the root, got:\n%s", ttmlOutput)
+	}
+
+	if _, err := ToVTTWithOptions(source, Options{Language: "en US"}); !errors.Is(err, ErrInvalidLanguage) {
+		t.Errorf("Expected ErrInvalidLanguage for an invalid override, got %v", err)
+	}
+}
+
+func TestToTTMLWithOptions_Metadata(t *testing.T) {
+	const source = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttm="http://www.w3.org/ns/ttml#metadata" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="25" xml:lang="en"><head><metadata><ttm:title>Old</ttm:title><ttm:desc>Kept</ttm:desc></metadata></head><body><div>
+<p begin="00:00:01:00" end="00:00:02:00">Hello</p>
+</div></body></tt>`
+
+	ttmlOutput, err := ToTTMLWithOptions(source, Options{Title: "New", Copyright: "2026 Example"})
+	if err != nil {
+		t.Fatalf("ToTTMLWithOptions failed: %v", err)
+	}
+	for _, want := range []string{"<ttm:title>New</ttm:title>", "<ttm:desc>Kept</ttm:desc>", "<ttm:copyright>2026 Example</ttm:copyright>"} {
+		if !strings.Contains(ttmlOutput, want) {
+			t.Errorf("Expected %s in output:\n%s", want, ttmlOutput)
+		}
+	}
+}